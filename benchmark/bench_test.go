@@ -122,9 +122,69 @@ func benchmarkScene(c config, b *testing.B) {
 	fast.Alpha = 0.5
 	fast.Delta = 6
 
+	epo := hq
+	epo.Split = bvh.EPOSAH(1)
+
 	c.benchLBVH(b, renderer, buffer)
 	c.benchPHR(b, "phr-hq", hq, renderer, buffer)
 	c.benchPHR(b, "phr-fast", fast, renderer, buffer)
+	c.benchPHR(b, "phr-epo", epo, renderer, buffer)
+
+	// Same tree as lbvh, but primary rays are traced in 8x8 packets
+	packets := *renderer
+	packets.PacketSize = 8
+	c.benchBuilder(b, "lbvh-packets", func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		return bvh.DefaultLBVH(p, m, runtime.NumCPU())
+	}, &packets, buffer)
+
+	// Same tree as lbvh, but all rays of a bounce are sorted and traced as a batch
+	wavefront := render.NewWavefrontRenderer()
+	wavefront.Spp = 1
+	c.benchBuilder(b, "lbvh-wavefront", func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		return bvh.DefaultLBVH(p, m, runtime.NumCPU())
+	}, wavefront, buffer)
+
+	// Same builder as lbvh, with other orders of the primitives
+	hilbert := bvh.DefaultLBVHOptions(runtime.NumCPU())
+	hilbert.Curve = bvh.HilbertCurve
+	c.benchBuilder(b, "lbvh-hilbert", func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		return bvh.LBVHWithOptions(p, m, scene.EnclosingCentroids(p), hilbert)
+	}, renderer, buffer)
+	adaptive := bvh.DefaultLBVHOptions(runtime.NumCPU())
+	adaptive.AdaptiveBits = true
+	c.benchBuilder(b, "lbvh-adaptive", func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		return bvh.LBVHWithOptions(p, m, scene.EnclosingCentroids(p), adaptive)
+	}, renderer, buffer)
+
+	// Same tree as lbvh, with all levels built in parallel
+	radixTree := bvh.DefaultLBVHOptions(runtime.NumCPU())
+	radixTree.Construction = bvh.RadixTreeConstruction
+	c.benchBuilder(b, "lbvh-radixtree", func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		return bvh.LBVHWithOptions(p, m, scene.EnclosingCentroids(p), radixTree)
+	}, renderer, buffer)
+
+	sah := bvh.NewDefaultSAHBuilder()
+	sbvh := bvh.NewDefaultSBVHBuilder()
+	ploc := bvh.NewDefaultPLOCBuilder()
+	c.benchBuilder(b, "sah", sah.Build, renderer, buffer)
+	c.benchBuilder(b, "sbvh", sbvh.Build, renderer, buffer)
+	c.benchBuilder(b, "ploc", ploc.Build, renderer, buffer)
+	c.benchBuilder(b, "trbvh", func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		tree := bvh.DefaultLBVH(p, m, runtime.NumCPU())
+		bvh.OptimizeTreelets(tree, 7, 3, runtime.NumCPU())
+		return tree
+	}, renderer, buffer)
+	c.benchBuilder(b, "lbvh4", func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		tree := bvh.DefaultLBVH(p, m, runtime.NumCPU())
+		tree.Collapse(4)
+		return tree
+	}, renderer, buffer)
+	c.benchBuilder(b, "reinsertion", func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		tree := bvh.DefaultLBVH(p, m, runtime.NumCPU())
+		optimizer := bvh.NewDefaultReinsertionOptimizer()
+		optimizer.Optimize(tree)
+		return tree
+	}, renderer, buffer)
 }
 
 type view struct {
@@ -156,9 +216,11 @@ func (o config) benchLBVH(b *testing.B, renderer render.Renderer, buff render.Bu
 		for i := 0; i < b.N; i++ {
 			tree = bvh.DefaultLBVH(p, m, runtime.NumCPU())
 		}
+		b.ReportMetric(tree.Cost(1, 1), "sah")
 	})
 
 	o.benchRender(b, "lbvh/render", tree, renderer, buff)
+	o.benchRender(b, "lbvh/render-flat", tree.Flatten(), renderer, buff)
 }
 
 func (o config) benchPHR(b *testing.B, name string, builder bvh.PhrBuilder, renderer render.Renderer, buff render.Buffer) {
@@ -172,12 +234,30 @@ func (o config) benchPHR(b *testing.B, name string, builder bvh.PhrBuilder, rend
 		for i := 0; i < b.N; i++ {
 			tree = builder.Refine(lbvh)
 		}
+		b.ReportMetric(tree.Cost(1, 1), "sah")
+	})
+
+	o.benchRender(b, name+"/render", tree, renderer, buff)
+	o.benchRender(b, name+"/render-flat", tree.Flatten(), renderer, buff)
+}
+
+func (o config) benchBuilder(b *testing.B, name string, build func([]scene.Primitive, []scene.Material) *bvh.BVH, renderer render.Renderer, buff render.Buffer) {
+	p, m := prepareScene(b, o.obj)
+
+	var tree *bvh.BVH
+
+	b.Run(name+"/build", func(b *testing.B) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree = build(p, m)
+		}
+		b.ReportMetric(tree.Cost(1, 1), "sah")
 	})
 
 	o.benchRender(b, name+"/render", tree, renderer, buff)
 }
 
-func (o config) benchRender(b *testing.B, name string, tree *bvh.BVH, renderer render.Renderer, buff render.Buffer) {
+func (o config) benchRender(b *testing.B, name string, tree bvh.Traversable, renderer render.Renderer, buff render.Buffer) {
 	for i, view := range o.views {
 		n := fmt.Sprintf("%s/view%d", name, i)
 		cam := view.toCam()
@@ -1,10 +1,12 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
 	"image/png"
 	"os"
 
+	"github.com/apex/log"
 	"github.com/schmizzel/go-graphics/pkg/bvh"
 	"github.com/schmizzel/go-graphics/pkg/math"
 	"github.com/schmizzel/go-graphics/pkg/render"
@@ -32,7 +34,20 @@ func (cfg *Config) render() (*render.PixelBuffer, error) {
 		return nil, fmt.Errorf("failed to build scene: %w", err)
 	}
 
-	tree := cfg.Process.buildBvh(scene.CollectPrimitives())
+	var tree *bvh.BVH
+	if cfg.Process.Instancing {
+		tree = bvh.BuildInstanced(scene, cfg.Process.buildBvh)
+	} else {
+		tree = cfg.Process.loadOrBuildBvh(scene.CollectPrimitives())
+	}
+
+	if cfg.Stats {
+		stats, err := json.MarshalIndent(tree.Stats(), "", "    ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode BVH statistics: %w", err)
+		}
+		fmt.Println(string(stats))
+	}
 
 	ar := float64(cfg.Image.Width) / float64(cfg.Image.Height)
 	buffer := render.NewPixelBuffer(cfg.Image.Width, cfg.Image.Height)
@@ -51,11 +66,26 @@ func (c Camera) toCamera(ar float64) *render.Camera {
 		LookAt(c.LookAt[0], c.LookAt[1], c.LookAt[2])
 }
 
-func (p Process) toRenderer() *render.ImageRenderer {
+func (p Process) toRenderer() render.Renderer {
 	if p.Heatmap {
 		return render.NewHeatmapRenderer(p.HeatmapThreshold)
 	}
 
+	if p.Wavefront {
+		r := render.NewWavefrontRenderer()
+		r.Spp = p.Spp
+		r.NumCPU = p.Threads
+		r.MissShader = &render.SkyMissShader{}
+		return r
+	}
+
+	if p.AmbientOcclusion > 0 {
+		r := render.NewAmbientOcclusionRenderer(16, p.AmbientOcclusion)
+		r.Spp = p.Spp
+		r.NumCPU = p.Threads
+		return r
+	}
+
 	r := render.NewDefaultRenderer()
 	r.Spp = p.Spp
 	r.NumCPU = p.Threads
@@ -63,22 +93,80 @@ func (p Process) toRenderer() *render.ImageRenderer {
 	return r
 }
 
+// Loads the BVH from the cache file if it was built from the same primitives with the same settings,
+// otherwise builds it and updates the cache
+func (process Process) loadOrBuildBvh(p []s.Primitive, m []s.Material) *bvh.BVH {
+	if process.BvhCache == "" {
+		return process.buildBvh(p, m)
+	}
+
+	if f, err := os.Open(process.BvhCache); err == nil {
+		tree, err := bvh.Load(f, p, m, process.bvhSettings())
+		f.Close()
+		if err == nil {
+			return tree
+		}
+	}
+
+	// The cache only saves build time, so failing to write it does not fail rendering
+	tree := process.buildBvh(p, m)
+	f, err := os.Create(process.BvhCache)
+	if err != nil {
+		log.Warnf("failed to create bvh cache: %s", err.Error())
+		return tree
+	}
+
+	err = tree.Write(f, process.bvhSettings())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Warnf("failed to write bvh cache: %s", err.Error())
+
+		// A truncated cache would fail to load anyway, but removing it avoids parsing it on every run
+		if err := os.Remove(process.BvhCache); err != nil {
+			log.Warnf("failed to remove incomplete bvh cache: %s", err.Error())
+		}
+	}
+	return tree
+}
+
+// Describes all settings used by buildBvh, so cached trees built with other settings are rebuilt
+func (process Process) bvhSettings() string {
+	return fmt.Sprintf("phr=%t alpha=%g delta=%g branching=%d maxLeafSize=%d collapseLeaves=%t threads=%d",
+		process.UsePhr, process.Alpha, process.Delta, process.BranchingFactor, process.MaxLeafSize, process.CollapseLeaves, process.Threads)
+}
+
 func (process Process) buildBvh(p []s.Primitive, m []s.Material) *bvh.BVH {
 	if process.UsePhr {
-		builder := bvh.NewPHRBuilder(process.Alpha, process.Delta, 2, process.Threads)
+		builder := bvh.NewPHRBuilder(process.Alpha, process.Delta, process.BranchingFactor, process.Threads)
 		return builder.BuildFromLBVH(p, m)
 	}
 
-	return bvh.DefaultLBVH(p, m, process.Threads)
+	options := bvh.DefaultLBVHOptions(process.Threads)
+	options.MaxLeafSize = process.MaxLeafSize
+	options.CollapseSAH = process.CollapseLeaves
+	tree := bvh.LBVHWithOptions(p, m, s.EnclosingCentroids(p), options)
+	if process.BranchingFactor > 2 {
+		tree.Collapse(process.BranchingFactor)
+	}
+	return tree
 }
 
 func (cfg *Config) toScene() (*s.Node, error) {
 	scene := s.NewNode()
 
+	// Objects loaded from the same file share their mesh
+	meshes := make(map[string]s.Mesh)
 	for _, o := range cfg.Scene.Objects {
-		obj, err := s.ParseFromPath(o.File)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse %s: %w", cfg.In, err)
+		obj, ok := meshes[o.File]
+		if !ok {
+			var err error
+			obj, err = s.ParseFromPath(o.File)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", cfg.In, err)
+			}
+			meshes[o.File] = obj
 		}
 
 		scale := math.Scale(o.Scale[0], o.Scale[1], o.Scale[2])
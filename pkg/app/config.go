@@ -9,12 +9,14 @@ import (
 	"strings"
 
 	"github.com/jessevdk/go-flags"
+	"github.com/schmizzel/go-graphics/pkg/bvh"
 	"github.com/schmizzel/go-graphics/pkg/scene"
 )
 
 type Config struct {
-	In  string `short:"f" long:"in" description:"Input file. Either a .obj or config json file" default:"config.json"`
-	Out string `short:"o" long:"out" description:"Output file" default:"out.png"`
+	In    string `short:"f" long:"in" description:"Input file. Either a .obj or config json file" default:"config.json"`
+	Out   string `short:"o" long:"out" description:"Output file" default:"out.png"`
+	Stats bool   `long:"stats" description:"If present, print statistics of the BVH as JSON before rendering"`
 
 	Scene   Scene `json:"scene"`
 	Image   Image `json:"image"`
@@ -46,14 +48,23 @@ func ParseConfig() (Config, error) {
 		return cfg, err
 	}
 
-	return cfg, err
+	return cfg, cfg.validate()
 }
 
 func ParseConfigFile(path string) (Config, error) {
 	cfg := NewDefaultConfig()
 	cfg.In = path
-	err := cfg.parseIn()
-	return cfg, err
+	if err := cfg.parseIn(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+func (cfg *Config) validate() error {
+	if cfg.Process.BranchingFactor < 2 {
+		return fmt.Errorf("branching factor must be at least 2, got %d", cfg.Process.BranchingFactor)
+	}
+	return nil
 }
 
 func (cfg Config) ToString() string {
@@ -87,7 +98,14 @@ type Process struct {
 	Alpha            float64 `json:"alpha" short:"a" long:"alpha" description:"Alpha parameter for PHR"`
 	Delta            float64 `json:"delta" short:"d" long:"delta" description:"Delta parameter for PHR"`
 	UsePhr           bool    `json:"usePhr" short:"p" long:"phr" description:"If present, apply PHR after initial BVH construction"`
+	BranchingFactor  int     `json:"branchingFactor" long:"branching" description:"Maximum number of children per BVH node, e.g. 4 or 8 for wide BVHs"`
+	MaxLeafSize      int     `json:"maxLeafSize" long:"maxLeafSize" description:"Maximum number of primitives per leaf of the LBVH"`
+	CollapseLeaves   bool    `json:"collapseLeaves" long:"collapseLeaves" description:"If present, merge subtrees of the LBVH into leaves where this lowers the SAH cost"`
+	Instancing       bool    `json:"instancing" long:"instancing" description:"If present, build a two-level BVH in which objects using the same file share their BVH"`
+	BvhCache         string  `json:"bvhCache" long:"bvhCache" description:"If present, the BVH is loaded from this file if it matches the scene and the BVH settings and written to it otherwise"`
 	Heatmap          bool    `json:"heatmap" long:"heatmap" description:"If present, render heatmap of the bvh"`
+	Wavefront        bool    `json:"wavefront" long:"wavefront" description:"If present, trace the rays of each bounce as a sorted batch instead of recursively"`
+	AmbientOcclusion float64 `json:"ambientOcclusion" long:"ao" description:"If greater than 0, render ambient occlusion with occluders up to this distance"`
 	HeatmapThreshold int     `json:"heatmapThreshold" long:"heatmapThreshold" description:"Threshold at which heatmap shows red"`
 }
 
@@ -98,6 +116,8 @@ func NewDefaultProcess() Process {
 		Alpha:            0.5,
 		Delta:            6,
 		UsePhr:           false,
+		BranchingFactor:  2,
+		MaxLeafSize:      bvh.DEFAULT_MAX_LEAF_SIZE,
 		Heatmap:          false,
 		HeatmapThreshold: 100,
 	}
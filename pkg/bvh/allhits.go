@@ -0,0 +1,85 @@
+package bvh
+
+import (
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Finds all intersections between tMin and tMax and stores them in out sorted by T.
+// At most len(out) hits are returned, if there are more only the closest ones are kept.
+// Returns the number of hits. Instances only report their closest hit.
+func (bvh *BVH) AllHits(ray m.Ray, tMin, tMax float64, out []scene.Hit) int {
+	if bvh.root == nil || len(out) == 0 {
+		return 0
+	}
+
+	q := allHitsQuery{ray: ray, tMin: tMin, tMax: tMax, out: out, bvh: bvh}
+	q.traverse(bvh.root)
+	return q.count
+}
+
+type allHitsQuery struct {
+	ray   m.Ray
+	tMin  float64
+	tMax  float64 // Shrinks to the farthest stored hit once out is full
+	out   []scene.Hit
+	count int
+	bvh   *BVH
+	hit   scene.Hit
+}
+
+func (q *allHitsQuery) traverse(n *node) {
+	if !n.aabb.Intersected(q.ray, q.tMin, q.tMax) {
+		return
+	}
+
+	if !n.isLeaf {
+		for _, child := range n.children {
+			q.traverse(child)
+		}
+		return
+	}
+
+	for _, pId := range n.pIds {
+		if !q.bvh.primitives[pId].Intersected(q.ray, q.tMin, q.tMax, &q.hit) {
+			continue
+		}
+		if q.bvh.splitReferences && q.contains(pId) {
+			continue
+		}
+
+		q.hit.Primitive = q.bvh.primitives[pId]
+		q.hit.Material = q.bvh.materials[pId]
+		q.hit.PrimitiveId = pId
+		q.insert(q.hit)
+	}
+}
+
+// Primitives referenced by multiple leaves must only be reported once
+func (q *allHitsQuery) contains(pId primitiveId) bool {
+	for _, hit := range q.out[:q.count] {
+		if hit.PrimitiveId == pId {
+			return true
+		}
+	}
+	return false
+}
+
+// Inserts the hit in sorted order, dropping the farthest hit if out is full
+func (q *allHitsQuery) insert(hit scene.Hit) {
+	i := q.count
+	if q.count < len(q.out) {
+		q.count++
+	} else {
+		i--
+	}
+
+	for ; i > 0 && q.out[i-1].T > hit.T; i-- {
+		q.out[i] = q.out[i-1]
+	}
+	q.out[i] = hit
+
+	if q.count == len(q.out) {
+		q.tMax = q.out[q.count-1].T
+	}
+}
@@ -0,0 +1,63 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllHits(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{Albedo: scene.NewColor(1, 0, 0)})
+	p, mat := s.CollectPrimitives()
+
+	sbvh := bvh.NewDefaultSBVHBuilder()
+	trees := map[string]*bvh.BVH{
+		"lbvh": bvh.DefaultLBVH(p, mat, runtime.NumCPU()),
+		"sbvh": sbvh.Build(p, mat),
+	}
+
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(0))
+			all := make([]scene.Hit, 64)
+			limited := make([]scene.Hit, 3)
+			for i := 0; i < 500; i++ {
+				origin := m.NewRandomVector(-3, 3, r)
+				ray := m.NewRay(origin, m.NewRandomVector(-1, 1, r).Sub(origin))
+
+				// Brute force reference
+				var expected []float64
+				hit := scene.Hit{}
+				for _, prim := range p {
+					if prim.Intersected(ray, 0.001, math.Inf(1), &hit) {
+						expected = append(expected, hit.T)
+					}
+				}
+				sort.Float64s(expected)
+
+				n := tree.AllHits(ray, 0.001, math.Inf(1), all)
+				require.Equal(t, len(expected), n)
+				for j := 0; j < n; j++ {
+					require.Equal(t, expected[j], all[j].T)
+					require.Equal(t, p[all[j].PrimitiveId], all[j].Primitive)
+					require.Equal(t, mat[all[j].PrimitiveId], all[j].Material)
+				}
+
+				n = tree.AllHits(ray, 0.001, math.Inf(1), limited)
+				require.Equal(t, min(len(expected), len(limited)), n)
+				for j := 0; j < n; j++ {
+					require.Equal(t, expected[j], limited[j].T)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package bvh
 
 import (
 	"fmt"
+	"math"
 	"sync"
 	"sync/atomic"
 
@@ -14,13 +15,24 @@ import (
 type BVH struct {
 	root *node
 
-	// TODO: Abscract primivive to arbitrary input?
+	// Arbitrary objects are wrapped into primitives by Tree
 	// TODO: Are prim mat pairs more efficient?
 	primitives []scene.Primitive
 	materials  []scene.Material
+
+	// Set by builders that may reference a primitive from multiple leaves, e.g. spatial splits
+	splitReferences bool
+
+	refitBaseline  float64       // SAH cost before the first refit
+	free           []primitiveId // Ids of removed primitives, reused on insertion
+	ownsPrimitives bool          // Set once primitives and materials are copied from the slices passed by the caller
 }
 
 func (bvh *BVH) ClosestHit(ray m.Ray, tMin, tMax float64, hitOut *scene.Hit) (ok bool) {
+	if bvh.root == nil {
+		return false
+	}
+
 	hitOut.T = tMax
 	return bvh.root.ClosestHit(ray, bvh, tMin, tMax, hitOut)
 }
@@ -30,9 +42,14 @@ func (bvh *BVH) ToString() string {
 }
 
 func (bvh *BVH) TraversalSteps(ray m.Ray, tMin, tMax float64) int {
+	if bvh.root == nil {
+		return 0
+	}
+
 	stack := stack.New(bvh.root)
 	hit := scene.Hit{T: tMax}
 	count := 0
+	var buf [8]childDistance[*node]
 
 	for {
 		count++
@@ -66,20 +83,18 @@ func (bvh *BVH) TraversalSteps(ray m.Ray, tMin, tMax float64) int {
 				stack.Push(node.children[1])
 			}
 		} else {
-			// TODO: Also sort by distance with higher number of children?
-			for _, child := range node.children {
-				stack.Push(child)
+			// Push in reverse, so the closest child is popped first
+			sorted := node.childrenByDistance(ray.Origin, buf[:])
+			for i := len(sorted) - 1; i >= 0; i-- {
+				stack.Push(sorted[i].child)
 			}
 		}
 	}
 }
 
+// Expected cost of a ray hitting the root with traversal cost ct and intersection cost ci, see CostModel
 func (bvh *BVH) Cost(ct, ci float64) float64 {
-	if bvh.root == nil {
-		return 0
-	}
-
-	return bvh.root.costSAH(ct, ci)
+	return CostModel{Traversal: ct, Intersection: ci}.Tree(bvh)
 }
 
 // TODO: There is probably a better way to do this
@@ -91,7 +106,7 @@ func (bvh *BVH) updateBounding(threads int) {
 
 	// TODO: Cache Leaves or add on construction?
 	leaves := make([]*node, 0, len(bvh.primitives))
-	bvh.root.collectLeaves(&leaves)
+	bvh.root.resetCounters(&leaves)
 
 	wg := sync.WaitGroup{}
 	wg.Add(threads)
@@ -113,6 +128,28 @@ func (bvh *BVH) updateBounding(threads int) {
 	wg.Wait()
 }
 
+// Splits the interval [0, n) into equally sized batches and processes each batch in its own goroutine
+func parallelBatches(n int, threads int, process func(start, end int)) {
+	batchSize := int(math.Ceil(float64(n) / float64(threads)))
+	wg := sync.WaitGroup{}
+	for i := 0; i < threads; i++ {
+		start := i * batchSize
+		if start >= n {
+			break
+		}
+		end := start + batchSize
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func() {
+			process(start, end)
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+
 type primitiveId = int
 
 // TODO: Test if polymorph node is slower (Node interface)
@@ -161,6 +198,17 @@ func (n *node) ClosestHit(ray m.Ray, bvh *BVH, tMin, tMax float64, hitOut *scene
 		return
 	}
 
+	if len(n.children) != 2 {
+		// Wide nodes are visited front to back, so closer hits can cull the remaining children
+		var buf [8]childDistance[*node]
+		for _, c := range n.childrenByDistance(ray.Origin, buf[:]) {
+			if c.child.ClosestHit(ray, bvh, tMin, hitOut.T, hitOut) {
+				ok = true
+			}
+		}
+		return ok
+	}
+
 	distA := n.children[0].aabb.Barycenter.Distance(ray.Origin)
 	distB := n.children[1].aabb.Barycenter.Distance(ray.Origin)
 
@@ -180,6 +228,16 @@ func (n *node) addChild(node *node, index int) {
 	node.parent = n
 }
 
+// Replaces the child old with the given node
+func (n *node) replaceChild(old *node, node *node) {
+	for i, child := range n.children {
+		if child == old {
+			n.addChild(node, i)
+			return
+		}
+	}
+}
+
 func (n *node) GetName() string {
 	if n.isLeaf {
 		return fmt.Sprintf("%d primitives", len(n.pIds))
@@ -206,6 +264,18 @@ func (node *node) collectLeaves(acc *[]*node) {
 	}
 }
 
+// Collects all leaves and resets the counters used for updating the AABBs of branches
+func (node *node) resetCounters(leaves *[]*node) {
+	if node.isLeaf {
+		*leaves = append(*leaves, node)
+		return
+	}
+	node.childAABBset = 0
+	for _, child := range node.children {
+		child.resetCounters(leaves)
+	}
+}
+
 func (node *node) subtreeSize() int {
 	if node.size == 0 {
 		node.size = 1
@@ -226,12 +296,15 @@ func enclosingSlice(indeces []int, primitives []scene.Primitive) scene.AABB {
 	return enclosing
 }
 
-// This fails when called on a leaf without parent, i.e. a bvh with a single node.
 func (node *node) updateAABB(primitives []scene.Primitive) {
 	if node.isLeaf {
 		node.aabb = enclosingSlice(node.pIds, primitives)
+		if node.parent == nil {
+			return
+		}
+
 		// Atomic counter. after all child bounding boxes have been computed the parents bounding box can be calculated
-		if atomic.AddUint32(&node.parent.childAABBset, 1)%uint32(len(node.parent.children)) == 0 {
+		if atomic.AddUint32(&node.parent.childAABBset, 1) == uint32(len(node.parent.children)) {
 			node.parent.updateAABB(primitives)
 		}
 		return
@@ -246,21 +319,21 @@ func (node *node) updateAABB(primitives []scene.Primitive) {
 	if node.parent == nil {
 		return
 	}
-	if atomic.AddUint32(&node.parent.childAABBset, 1)%uint32(len(node.parent.children)) == 0 {
+	if atomic.AddUint32(&node.parent.childAABBset, 1) == uint32(len(node.parent.children)) {
 		node.parent.updateAABB(primitives)
 	}
 }
 
-func (node *node) costSAH(ct, ci float64) float64 {
+func (node *node) costSAH(c CostModel) float64 {
 	if node.isLeaf {
-		return ci * float64(len(node.pIds))
+		return c.Intersection * float64(len(node.pIds))
 	}
 
 	cost := 0.0
 	for _, child := range node.children {
 		p := float64(child.aabb.Surface()) / float64(node.aabb.Surface())
-		cost += p * child.costSAH(ci, ct)
+		cost += p * child.costSAH(c)
 	}
 
-	return ct + cost
+	return c.Traversal + cost
 }
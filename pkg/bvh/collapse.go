@@ -0,0 +1,84 @@
+package bvh
+
+import m "github.com/schmizzel/go-graphics/pkg/math"
+
+// Converts the tree in place into a wide BVH where every branch has up to width children, e.g. 4 or 8.
+// Starting at the root, the child whose replacement by its own children lowers the SAH cost the most is repeatedly
+// replaced, as long as the cost decreases. Visiting a wide branch tests the boxes of all its children, so the traversal
+// cost of a branch grows with its width, while the intersection costs stay the same.
+func (bvh *BVH) Collapse(width int) {
+	if bvh.root == nil || width < 2 {
+		return
+	}
+	bvh.root.collapse(width, DefaultCostModel())
+}
+
+func (n *node) collapse(width int, c CostModel) {
+	if n.isLeaf {
+		return
+	}
+
+	for len(n.children) < width {
+		best := -1
+		bestCost := 0.0
+		for i, child := range n.children {
+			fits := len(n.children)-1+len(child.children) <= width
+			if !child.isLeaf && fits {
+				if cost := n.openingCost(child, c); cost < bestCost {
+					best = i
+					bestCost = cost
+				}
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		opened := n.children[best]
+		n.addChild(opened.children[0], best)
+		for _, grandchild := range opened.children[1:] {
+			n.children = append(n.children, grandchild)
+			grandchild.parent = n
+		}
+	}
+
+	n.size = 0
+	for _, child := range n.children {
+		child.collapse(width, c)
+	}
+}
+
+// Change of the SAH cost, not normalized by the surface of n, if the child is replaced by its own children.
+// Opening the child adds its children to the boxes tested by n, but saves visiting the child
+func (n *node) openingCost(child *node, c CostModel) float64 {
+	width := len(n.children)
+	k := len(child.children)
+	surface := n.aabb.Surface()
+	return c.WideBranch(surface, width-1+k) - c.WideBranch(surface, width) - c.WideBranch(child.aabb.Surface(), k)
+}
+
+// Child paired with the distance of its center to the ray origin
+type childDistance[T any] struct {
+	child T
+	dist  float64
+}
+
+// Sorts the children front to back. Uses insertion sort, as nodes only have a few children
+func sortChildren[T any](children []childDistance[T]) {
+	for i := 1; i < len(children); i++ {
+		for j := i; j > 0 && children[j].dist < children[j-1].dist; j-- {
+			children[j], children[j-1] = children[j-1], children[j]
+		}
+	}
+}
+
+// Returns the children of the node ordered by the distance of their centers to the given point.
+// The result is stored in buf if it is large enough
+func (n *node) childrenByDistance(point m.Vector3, buf []childDistance[*node]) []childDistance[*node] {
+	sorted := buf[:0]
+	for _, child := range n.children {
+		sorted = append(sorted, childDistance[*node]{child: child, dist: child.aabb.Barycenter.Sub(point).LengthSquared()})
+	}
+	sortChildren(sorted)
+	return sorted
+}
@@ -0,0 +1,56 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWideBVH(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{Albedo: scene.NewColor(1, 0, 0)})
+	p, mat := s.CollectPrimitives()
+
+	binary := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	bvh4 := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	bvh4.Collapse(4)
+	bvh8 := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	bvh8.Collapse(8)
+	require.Less(t, bvh4.Cost(1, 1), binary.Cost(1, 1))
+	require.Less(t, bvh8.Cost(1, 1), bvh4.Cost(1, 1))
+	require.NoError(t, bvh4.Validate())
+	require.NoError(t, bvh8.Validate())
+
+	phr := bvh.NewPHRBuilder(0.5, 6, 4, runtime.NumCPU())
+	trees := map[string]bvh.Traversable{
+		"bvh4":      bvh4,
+		"bvh8":      bvh8,
+		"bvh8-flat": bvh8.Flatten(),
+		"phr4":      phr.BuildFromLBVH(p, mat),
+	}
+
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(0))
+			for i := 0; i < 1000; i++ {
+				origin := m.NewRandomVector(-3, 3, r)
+				ray := m.NewRay(origin, m.NewRandomVector(-1, 1, r).Sub(origin))
+
+				expected := scene.Hit{}
+				actual := scene.Hit{}
+				ok := binary.ClosestHit(ray, 0.001, math.Inf(1), &expected)
+				require.Equal(t, ok, tree.ClosestHit(ray, 0.001, math.Inf(1), &actual))
+				if ok {
+					require.Equal(t, expected.T, actual.T)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package bvh
+
+import "github.com/schmizzel/go-graphics/pkg/scene"
+
+// Weighs traversal steps against primitive intersections in the surface area heuristic
+type CostModel struct {
+	Traversal    float64 // Cost of visiting a branch
+	Intersection float64 // Cost of intersecting a primitive
+}
+
+func DefaultCostModel() CostModel {
+	return CostModel{
+		Traversal:    sahTraversalCost,
+		Intersection: sahIntersectionCost,
+	}
+}
+
+// Cost of a leaf with count primitives, not normalized by the surface of its parent
+func (c CostModel) Leaf(surface float64, count int) float64 {
+	return c.Intersection * surface * float64(count)
+}
+
+// Cost of a branch whose two children are leaves, not normalized by the surface of its parent
+func (c CostModel) Branch(surface float64, left scene.AABB, leftCount int, right scene.AABB, rightCount int) float64 {
+	return c.Traversal*surface + c.Leaf(left.Surface(), leftCount) + c.Leaf(right.Surface(), rightCount)
+}
+
+// Cost of visiting a branch with the given number of children, not normalized by the surface of its parent.
+// Visiting a branch tests the boxes of all its children, so the cost grows with the width relative to a binary branch
+func (c CostModel) WideBranch(surface float64, children int) float64 {
+	return c.Traversal * surface * float64(children) / 2
+}
+
+// Expected cost of a ray hitting the root, see BVH.Cost
+func (c CostModel) Tree(bvh *BVH) float64 {
+	if bvh.root == nil {
+		return 0
+	}
+
+	return bvh.root.costSAH(c)
+}
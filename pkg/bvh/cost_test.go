@@ -0,0 +1,53 @@
+package bvh_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostModel(t *testing.T) {
+	// Two unit triangles far apart, so each ends up in its own leaf
+	p := []scene.Primitive{
+		scene.NewTriangleWithoutNormals(m.NewVector3(0, 0, 0), m.NewVector3(1, 0, 0), m.NewVector3(0, 1, 0)),
+		scene.NewTriangleWithoutNormals(m.NewVector3(9, 0, 0), m.NewVector3(10, 0, 0), m.NewVector3(9, 1, 0)),
+	}
+	options := bvh.DefaultLBVHOptions(runtime.NumCPU())
+	options.MaxLeafSize = 1
+	tree := bvh.LBVHWithOptions(p, make([]scene.Material, len(p)), scene.EnclosingCentroids(p), options)
+	require.Equal(t, 3, tree.Stats().Nodes)
+
+	// Only the root is traversed, the flat leaves of surface 2 are intersected relative to the root surface of 20
+	leaves := 2 * 2.0 / 20
+	require.InDelta(t, 1.0, tree.Cost(1, 0), 1e-9)
+	require.InDelta(t, leaves, tree.Cost(0, 1), 1e-9)
+	require.InDelta(t, 2+3*leaves, tree.Cost(2, 3), 1e-9)
+
+	model := bvh.CostModel{Traversal: 2, Intersection: 3}
+	require.Equal(t, tree.Cost(2, 3), model.Tree(tree))
+
+	// A binary branch costs one traversal, a branch with four children twice as much
+	box := p[0].Bounding()
+	require.Equal(t, model.Branch(20, box, 0, box, 0), model.WideBranch(20, 2))
+	require.Equal(t, 2*model.WideBranch(20, 2), model.WideBranch(20, 4))
+
+	// Two pairs of triangles, so the leaves are two levels below the root. Costs passed to the children in swapped
+	// order would weigh the branches with the intersection cost and the leaves with the traversal cost
+	p = append(p,
+		scene.NewTriangleWithoutNormals(m.NewVector3(90, 0, 0), m.NewVector3(91, 0, 0), m.NewVector3(90, 1, 0)),
+		scene.NewTriangleWithoutNormals(m.NewVector3(99, 0, 0), m.NewVector3(100, 0, 0), m.NewVector3(99, 1, 0)),
+	)
+	tree = bvh.LBVHWithOptions(p, make([]scene.Material, len(p)), scene.EnclosingCentroids(p), options)
+	require.Equal(t, []int{0, 0, 4}, tree.Stats().DepthHistogram)
+
+	// Both branches of surface 20 and all leaves of surface 2 are relative to the root surface of 200
+	branches := 2 * 20.0 / 200
+	leaves = 4 * 2.0 / 200
+	require.InDelta(t, 1+branches, tree.Cost(1, 0), 1e-9)
+	require.InDelta(t, leaves, tree.Cost(0, 1), 1e-9)
+	require.InDelta(t, 2*(1+branches)+3*leaves, tree.Cost(2, 3), 1e-9)
+}
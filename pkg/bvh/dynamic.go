@@ -0,0 +1,146 @@
+package bvh
+
+import (
+	"fmt"
+
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Adds a primitive to the tree without rebuilding it. The new leaf becomes the sibling of the node
+// where it increases the SAH cost the least. Returns the id of the primitive, which is needed to remove it again.
+func (bvh *BVH) Insert(prim scene.Primitive, material scene.Material) int {
+	bvh.ownPrimitives()
+	var id primitiveId
+	if len(bvh.free) > 0 {
+		id = bvh.free[len(bvh.free)-1]
+		bvh.free = bvh.free[:len(bvh.free)-1]
+		bvh.primitives[id] = prim
+		bvh.materials[id] = material
+	} else {
+		id = len(bvh.primitives)
+		bvh.primitives = append(bvh.primitives, prim)
+		bvh.materials = append(bvh.materials, material)
+	}
+
+	leaf := newLeaf([]primitiveId{id})
+	leaf.aabb = prim.Bounding()
+	if bvh.root == nil {
+		bvh.root = leaf
+		return id
+	}
+
+	bvh.insertSubtree(leaf, newBranch(2))
+	return id
+}
+
+// Removes the primitive from the tree. Leaves that become empty are removed and if their parent is left
+// with a single child, that child takes the place of the parent. Bounding boxes of all ancestors are refitted.
+// The id of the removed primitive may be reused by subsequent insertions.
+func (bvh *BVH) Remove(id int) error {
+	if id < 0 || id >= len(bvh.primitives) || bvh.primitives[id] == nil {
+		return fmt.Errorf("primitive %d is not part of the bvh", id)
+	}
+
+	leaves := make([]*node, 0, 1)
+	if bvh.root != nil {
+		bvh.root.findLeaves(id, bvh.primitives[id].Bounding(), &leaves)
+	}
+	if len(leaves) == 0 {
+		return fmt.Errorf("primitive %d is not referenced by any leaf", id)
+	}
+
+	for _, leaf := range leaves {
+		pIds := make([]primitiveId, 0, len(leaf.pIds)-1)
+		for _, pId := range leaf.pIds {
+			if pId != id {
+				pIds = append(pIds, pId)
+			}
+		}
+		leaf.pIds = pIds
+
+		if len(pIds) == 0 {
+			bvh.removeLeaf(leaf)
+			continue
+		}
+
+		// Leaves with split references are bounded by clipped primitives, their old box stays conservative
+		if !bvh.splitReferences {
+			leaf.aabb = enclosingSlice(pIds, bvh.primitives)
+			refitAncestors(leaf.parent)
+		}
+	}
+
+	bvh.ownPrimitives()
+	bvh.primitives[id] = nil
+	bvh.materials[id] = nil
+	bvh.free = append(bvh.free, id)
+	return nil
+}
+
+// Copies primitives and materials before they are modified for the first time, so the slices the tree was
+// built from are left untouched. Appending could otherwise write into their spare capacity as well
+func (bvh *BVH) ownPrimitives() {
+	if bvh.ownsPrimitives {
+		return
+	}
+	bvh.primitives = append([]scene.Primitive{}, bvh.primitives...)
+	bvh.materials = append([]scene.Material{}, bvh.materials...)
+	bvh.ownsPrimitives = true
+}
+
+// Collects all leaves referencing the primitive, only descending into nodes overlapping its bounding box
+func (n *node) findLeaves(id primitiveId, box scene.AABB, acc *[]*node) {
+	if !n.aabb.Overlaps(box) {
+		return
+	}
+
+	if n.isLeaf {
+		for _, pId := range n.pIds {
+			if pId == id {
+				*acc = append(*acc, n)
+				return
+			}
+		}
+		return
+	}
+
+	for _, child := range n.children {
+		child.findLeaves(id, box, acc)
+	}
+}
+
+// Detaches the leaf. If the parent is left with a single child, the child replaces the parent
+func (bvh *BVH) removeLeaf(leaf *node) {
+	parent := leaf.parent
+	if parent == nil {
+		bvh.root = nil
+		return
+	}
+
+	if len(parent.children) > 2 {
+		children := make([]*node, 0, len(parent.children)-1)
+		for _, child := range parent.children {
+			if child != leaf {
+				children = append(children, child)
+			}
+		}
+		parent.children = children
+		refitAncestors(parent)
+		return
+	}
+
+	sibling := parent.children[0]
+	if sibling == leaf {
+		sibling = parent.children[1]
+	}
+
+	if parent.parent == nil {
+		bvh.root = sibling
+		sibling.parent = nil
+		return
+	}
+
+	grandparent := parent.parent
+	grandparent.replaceChild(parent, sibling)
+	refitAncestors(grandparent)
+}
@@ -0,0 +1,92 @@
+package bvh_test
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertRemove(t *testing.T) {
+	// Spheres on a grid in the xy-plane so they never occlude each other along the z-axis
+	count := 0
+	sphere := func() scene.Primitive {
+		x, y := count%20, count/20
+		count++
+		return scene.NewSphere(0.5).SetCenter(float64(x)*2, float64(y)*2, 0)
+	}
+
+	p := make([]scene.Primitive, 100)
+	mat := make([]scene.Material, len(p))
+	for i := range p {
+		p[i] = sphere()
+		mat[i] = scene.Diffuse{}
+	}
+	original := append([]scene.Primitive{}, p...)
+	tree := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+
+	// Shoot a ray at the center of every primitive and check that it is hit at the expected distance
+	requireHit := func(prim scene.Primitive, expected bool) {
+		center := prim.Bounding().Barycenter
+		ray := m.NewRay(center.Add(m.NewVector3(0, 0, 100)), m.NewVector3(0, 0, -1))
+		hit := scene.Hit{}
+		ok := tree.ClosestHit(ray, 0.001, math.Inf(1), &hit)
+		if expected {
+			require.True(t, ok)
+		}
+		if ok {
+			require.Equal(t, expected, math.Abs(hit.T-99.5) < 1e-9)
+		}
+	}
+
+	for i := 0; i < len(p); i += 2 {
+		require.NoError(t, tree.Remove(i))
+	}
+	require.Error(t, tree.Remove(0))
+	require.NoError(t, tree.Validate())
+
+	// The tree copies the slices before modifying them, the ones it was built from belong to the caller
+	require.Equal(t, original, p)
+	require.NotContains(t, mat, nil)
+	for i, prim := range original {
+		requireHit(prim, i%2 == 1)
+	}
+
+	inserted := make([]scene.Primitive, 80)
+	for i := range inserted {
+		inserted[i] = sphere()
+		tree.Insert(inserted[i], scene.Diffuse{})
+	}
+	require.NoError(t, tree.Validate())
+	for _, prim := range inserted {
+		requireHit(prim, true)
+	}
+
+	// Removing everything leaves an empty tree that can be filled again
+	for i := 0; i < len(p)+30; i++ {
+		if i%2 == 1 || i >= len(p) {
+			require.NoError(t, tree.Remove(i))
+		}
+	}
+	for i := 0; i < len(p); i += 2 {
+		require.NoError(t, tree.Remove(i))
+	}
+	require.Equal(t, 0.0, tree.Cost(1, 1))
+	require.NoError(t, tree.Validate())
+
+	prim := sphere()
+	tree.Insert(prim, scene.Diffuse{})
+	requireHit(prim, true)
+
+	// Insertions must not append into the spare capacity of the slices either
+	spare := make([]scene.Primitive, 2, 3)
+	spare[0], spare[1] = sphere(), sphere()
+	tree = bvh.DefaultLBVH(spare[:2], make([]scene.Material, 2, 3), runtime.NumCPU())
+	tree.Insert(sphere(), scene.Diffuse{})
+	require.Nil(t, spare[:3][2])
+	require.NoError(t, tree.Validate())
+}
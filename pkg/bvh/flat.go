@@ -0,0 +1,167 @@
+package bvh
+
+import (
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Implemented by all acceleration structures that can be rendered
+type Traversable interface {
+	ClosestHit(ray m.Ray, tMin, tMax float64, hitOut *scene.Hit) bool
+	Occluded(ray m.Ray, tMin, tMax float64) bool
+	TraversalSteps(ray m.Ray, tMin, tMax float64) int
+}
+
+// Read-only BVH stored as a flat array of fixed-size nodes in depth-first order.
+// The first child of a branch directly follows it, every further child follows the subtree of its previous sibling.
+// Primitives are reordered so that every leaf references a contiguous range.
+type FlatBVH struct {
+	nodes      []flatNode
+	primitives []scene.Primitive
+	materials  []scene.Material
+	ids        []primitiveId // Id of each reordered primitive in the flattened tree
+}
+
+// 64 bytes, so a node fits into a single cache line
+type flatNode struct {
+	bounds   [2]m.Vector3
+	offset   int32 // Index of the first primitive of a leaf
+	count    int32 // Number of primitives of a leaf, 0 for branches
+	skip     int32 // Index of the node following this subtree, which is the next sibling if there is one
+	children int32 // Number of children of a branch
+}
+
+// Compacts the tree into a flat layout optimized for traversal.
+// The flat BVH does not reflect later changes to the tree.
+func (bvh *BVH) Flatten() *FlatBVH {
+	flat := &FlatBVH{}
+	if bvh.root == nil {
+		return flat
+	}
+
+	size := bvh.root.subtreeSize()
+	flat.nodes = make([]flatNode, 0, size)
+	flat.primitives = make([]scene.Primitive, 0, len(bvh.primitives))
+	flat.materials = make([]scene.Material, 0, len(bvh.primitives))
+	flat.ids = make([]primitiveId, 0, len(bvh.primitives))
+	flat.flatten(bvh.root, bvh)
+	return flat
+}
+
+func (flat *FlatBVH) flatten(n *node, bvh *BVH) {
+	i := len(flat.nodes)
+	flat.nodes = append(flat.nodes, flatNode{bounds: n.aabb.Bounds})
+
+	if n.isLeaf {
+		flat.nodes[i].offset = int32(len(flat.primitives))
+		flat.nodes[i].count = int32(len(n.pIds))
+		for _, pId := range n.pIds {
+			flat.primitives = append(flat.primitives, bvh.primitives[pId])
+			flat.materials = append(flat.materials, bvh.materials[pId])
+			flat.ids = append(flat.ids, pId)
+		}
+	} else {
+		flat.nodes[i].children = int32(len(n.children))
+		for _, child := range n.children {
+			flat.flatten(child, bvh)
+		}
+	}
+
+	flat.nodes[i].skip = int32(len(flat.nodes))
+}
+
+func (flat *FlatBVH) ClosestHit(ray m.Ray, tMin, tMax float64, hitOut *scene.Hit) (ok bool) {
+	if len(flat.nodes) == 0 {
+		return false
+	}
+
+	hitOut.T = tMax
+	stack := make([]int32, 1, 64)
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		n := &flat.nodes[i]
+		if !scene.BoundsIntersected(&n.bounds, ray, tMin, hitOut.T) {
+			continue
+		}
+
+		if n.count > 0 {
+			for j := n.offset; j < n.offset+n.count; j++ {
+				if flat.primitives[j].Intersected(ray, tMin, hitOut.T, hitOut) {
+					ok = true
+					hitOut.Material = flat.materials[j]
+				}
+			}
+			continue
+		}
+
+		stack = flat.pushChildren(stack, i, ray)
+	}
+
+	return ok
+}
+
+// Counts the visited nodes and intersection tests in the same way as BVH.TraversalSteps
+func (flat *FlatBVH) TraversalSteps(ray m.Ray, tMin, tMax float64) int {
+	if len(flat.nodes) == 0 {
+		return 0
+	}
+
+	hit := scene.Hit{T: tMax}
+	count := 0
+	stack := make([]int32, 1, 64)
+	for {
+		count++
+		if len(stack) == 0 {
+			return count
+		}
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		n := &flat.nodes[i]
+		if !scene.BoundsIntersected(&n.bounds, ray, tMin, hit.T) {
+			continue
+		}
+
+		for j := n.offset; j < n.offset+n.count; j++ {
+			count++
+			flat.primitives[j].Intersected(ray, tMin, hit.T, &hit)
+		}
+
+		stack = flat.pushChildren(stack, i, ray)
+	}
+}
+
+// Pushes the children of the branch at index i, so that they are popped in order of their distance to the ray origin
+func (flat *FlatBVH) pushChildren(stack []int32, i int32, ray m.Ray) []int32 {
+	n := &flat.nodes[i]
+	if n.children == 2 {
+		a := i + 1
+		b := flat.nodes[a].skip
+		if flat.nodes[a].center().Sub(ray.Origin).LengthSquared() < flat.nodes[b].center().Sub(ray.Origin).LengthSquared() {
+			return append(stack, b, a)
+		}
+		return append(stack, a, b)
+	}
+
+	var buf [8]childDistance[int32]
+	sorted := buf[:0]
+	child := i + 1
+	for c := int32(0); c < n.children; c++ {
+		dist := flat.nodes[child].center().Sub(ray.Origin).LengthSquared()
+		sorted = append(sorted, childDistance[int32]{child: child, dist: dist})
+		child = flat.nodes[child].skip
+	}
+	sortChildren(sorted)
+
+	// Push in reverse, so the closest child is popped first
+	for c := len(sorted) - 1; c >= 0; c-- {
+		stack = append(stack, sorted[c].child)
+	}
+	return stack
+}
+
+func (n *flatNode) center() m.Vector3 {
+	return n.bounds[0].Add(n.bounds[1]).Mul(0.5)
+}
@@ -0,0 +1,52 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlatten(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{Albedo: scene.NewColor(1, 0, 0)})
+	p, mat := s.CollectPrimitives()
+
+	phr := bvh.NewDefaultPHRBuilder()
+	sbvh := bvh.NewDefaultSBVHBuilder()
+	trees := map[string]*bvh.BVH{
+		"lbvh": bvh.DefaultLBVH(p, mat, runtime.NumCPU()),
+		"phr":  phr.Refine(bvh.DefaultLBVH(p, mat, runtime.NumCPU())),
+		"sbvh": sbvh.Build(p, mat),
+	}
+
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			flat := tree.Flatten()
+			r := rand.New(rand.NewSource(0))
+			for i := 0; i < 1000; i++ {
+				origin := m.NewRandomVector(-3, 3, r)
+				ray := m.NewRay(origin, m.NewRandomVector(-1, 1, r).Sub(origin))
+
+				expected := scene.Hit{}
+				actual := scene.Hit{}
+				ok := tree.ClosestHit(ray, 0.001, math.Inf(1), &expected)
+				require.Equal(t, ok, flat.ClosestHit(ray, 0.001, math.Inf(1), &actual))
+				if ok {
+					require.Equal(t, expected.T, actual.T)
+					require.Equal(t, expected.Material, actual.Material)
+				}
+			}
+		})
+	}
+
+	empty := bvh.NewDefaultSAHBuilder()
+	flat := empty.Build(nil, nil).Flatten()
+	require.False(t, flat.ClosestHit(m.NewRay(m.NewVector3(0, 0, 0), m.NewVector3(0, 0, 1)), 0.001, math.Inf(1), &scene.Hit{}))
+}
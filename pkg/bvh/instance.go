@@ -0,0 +1,108 @@
+package bvh
+
+import (
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+type BuildFunction func([]scene.Primitive, []scene.Material) *BVH
+
+// Builds a two-level BVH for the scene. Every distinct mesh gets its own bottom-level BVH in object space,
+// which is shared by all nodes referencing the mesh. The top-level BVH is built over the instances.
+func BuildInstanced(root *scene.Node, build BuildFunction) *BVH {
+	trees := make(map[scene.Mesh]*BVH)
+	var instances []scene.Primitive
+	var materials []scene.Material
+
+	for _, mesh := range root.CollectInstances() {
+		tree, ok := trees[mesh.Mesh]
+		if !ok {
+			p := mesh.Mesh.Primitives()
+			tree = build(p, make([]scene.Material, len(p)))
+			trees[mesh.Mesh] = tree
+		}
+		if tree.root == nil {
+			continue
+		}
+
+		instances = append(instances, NewInstance(tree, mesh.Transform, mesh.Material))
+		materials = append(materials, mesh.Material)
+	}
+
+	return build(instances, materials)
+}
+
+// Bottom-level BVH placed in the scene. Implements scene.Primitive, so instances can be used as the primitives
+// of a top-level BVH. Rays are transformed into the object space of the bottom-level BVH.
+type Instance struct {
+	Tree      *BVH
+	Transform m.Matrix4
+	Material  scene.Material // Used for the whole instance, materials of the bottom-level BVH are ignored
+
+	inverse         m.Matrix4
+	normalTransform m.Matrix4
+	mirrored        bool // The transformation flips the orientation of triangles
+	box             scene.AABB
+}
+
+func NewInstance(tree *BVH, t m.Matrix4, material scene.Material) *Instance {
+	inst := &Instance{
+		Tree:            tree,
+		Transform:       t,
+		Material:        material,
+		inverse:         t.Inverse(),
+		normalTransform: t.Transpose().Inverse(),
+		mirrored:        t.LinearDeterminant() < 0,
+	}
+
+	// Transform all corners of the object space bounding box
+	bounds := tree.root.aabb.Bounds
+	for i := 0; i < 8; i++ {
+		corner := m.NewVector3(bounds[i&1].X, bounds[(i>>1)&1].Y, bounds[(i>>2)&1].Z)
+		corner = corner.ToPoint().Transformed(t).ToV3()
+		if i == 0 {
+			inst.box = scene.NewAABB(corner, corner)
+		} else {
+			inst.box = inst.box.Add(scene.NewAABB(corner, corner))
+		}
+	}
+	return inst
+}
+
+func (inst *Instance) Bounding() scene.AABB {
+	return inst.box
+}
+
+func (inst *Instance) Primitives() []scene.Primitive {
+	return []scene.Primitive{inst}
+}
+
+func (inst *Instance) Transformed(t m.Matrix4) scene.Primitive {
+	return NewInstance(inst.Tree, t.MultiplyMatrix(inst.Transform), inst.Material)
+}
+
+// Normals are transformed in the same way as for transformed primitives
+func (inst *Instance) Intersected(ray m.Ray, tMin, tMax float64, hitOut *scene.Hit) bool {
+	hit := scene.Hit{}
+	if !inst.Tree.ClosestHit(inst.toObjectSpace(ray), tMin, tMax, &hit) {
+		return false
+	}
+
+	hitOut.T = hit.T
+	hitOut.Point = ray.At(hit.T)
+	hitOut.Normal = hit.Normal.ToVector().Transformed(inst.normalTransform).ToV3()
+	hitOut.FrontFace = hit.FrontFace != inst.mirrored
+	if inst.mirrored {
+		hitOut.Normal = hitOut.Normal.Mul(-1)
+	}
+	hitOut.Material = inst.Material
+	return true
+}
+
+// The direction of the object space ray is not normalized, so distances along both rays are identical
+func (inst *Instance) toObjectSpace(ray m.Ray) m.Ray {
+	return m.NewRay(
+		ray.Origin.ToPoint().Transformed(inst.inverse).ToV3(),
+		ray.Direction.ToVector().Transformed(inst.inverse).ToV3(),
+	)
+}
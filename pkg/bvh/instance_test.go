@@ -0,0 +1,62 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstancing(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+
+	// The same mesh placed multiple times, including a mirrored and a non uniformly scaled instance
+	root := scene.NewNode()
+	for i := 0; i < 10; i++ {
+		material := scene.Diffuse{Albedo: scene.NewColor(float64(i)/10, 0, 0)}
+		node := scene.NewNode().SetMesh(mesh).SetMaterial(material)
+		switch i {
+		case 3:
+			node.Transform(m.Scale(-1, 1, 1))
+		case 5:
+			node.Transform(m.Scale(0.5, 2, 1))
+		}
+		node.Transform(m.IdentityMatrix().Rotate(m.NewVector3(0, 1, 0), float64(i)))
+		node.Translate(float64(i%5)*3-6, float64(i/5)*3-1.5, 0)
+		root.AddChild(node)
+	}
+
+	build := func(p []scene.Primitive, mat []scene.Material) *bvh.BVH {
+		return bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	}
+	baked := build(root.CollectPrimitives())
+	instanced := bvh.BuildInstanced(root, build)
+
+	r := rand.New(rand.NewSource(0))
+	hits := 0
+	for i := 0; i < 2000; i++ {
+		origin := m.NewRandomVector(-10, 10, r).WithComponent(2, 10)
+		ray := m.NewRay(origin, m.NewRandomVector(-8, 8, r).WithComponent(2, 0).Sub(origin))
+
+		expected := scene.Hit{}
+		actual := scene.Hit{}
+		ok := baked.ClosestHit(ray, 0.001, math.Inf(1), &expected)
+		require.Equal(t, ok, instanced.ClosestHit(ray, 0.001, math.Inf(1), &actual))
+		if !ok {
+			continue
+		}
+
+		hits++
+		require.InDelta(t, expected.T, actual.T, 1e-9)
+		require.Equal(t, expected.FrontFace, actual.FrontFace)
+		require.Equal(t, expected.Material, actual.Material)
+		require.InDelta(t, 0, expected.Normal.Sub(actual.Normal).Length(), 1e-9)
+	}
+	require.Greater(t, hits, 100)
+}
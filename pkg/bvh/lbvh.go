@@ -6,19 +6,85 @@ import (
 
 	"github.com/schmizzel/go-graphics/pkg/internal/morton"
 	"github.com/schmizzel/go-graphics/pkg/internal/sort"
+	m "github.com/schmizzel/go-graphics/pkg/math"
 	"github.com/schmizzel/go-graphics/pkg/scene"
 )
 
 const BUCKET_COUNT = 4096
 
+// Quantizes the primitive centroids within their bounds, which uses the precision of the codes better than the
+// bounds of the whole primitives
 func DefaultLBVH(prims []scene.Primitive, materials []scene.Material, threads int) *BVH {
-	return LBVH(prims, materials, scene.EnclosingAABB(prims), threads)
+	return LBVH(prims, materials, scene.EnclosingCentroids(prims), threads)
 }
 
+// Sorts the primitives along a space-filling curve through the enclosing box, which should contain all primitive centroids
 func LBVH(prims []scene.Primitive, materials []scene.Material, enclosing scene.AABB, threads int) *BVH {
-	pairs := assignMortonCodes(prims, enclosing, threads)
-	sortMortonPairs(pairs, threads)
-	root := constructLBVH(pairs, morton.MORTON_SIZE, threads)
+	return LBVHWithOptions(prims, materials, enclosing, DefaultLBVHOptions(threads))
+}
+
+type SpaceFillingCurve int
+
+const (
+	MortonCurve  SpaceFillingCurve = iota // Z-order
+	HilbertCurve                          // Neighbouring codes are always neighbouring cells, but slower to compute
+)
+
+type SortAlgorithm int
+
+const (
+	BucketSortAlgorithm SortAlgorithm = iota // Slows down if the codes are concentrated in few buckets, e.g. for dense meshes in large scenes
+	RadixSortAlgorithm                       // Stable, runtime only depends on the number of primitives
+)
+
+type LBVHConstruction int
+
+const (
+	TopDownConstruction   LBVHConstruction = iota // Splits ranges recursively, the upper levels are built by few threads
+	RadixTreeConstruction                         // Builds all branches independently (Karras 2012)
+)
+
+type LBVHOptions struct {
+	Threads      int
+	MaxLeafSize  int               // Primitives with equal Morton codes are split by their sorted order into leaves of at most this size
+	MinLeafSize  int               // Intervals of the sorted primitives with at most this many primitives always form a leaf
+	CollapseSAH  bool              // Merge subtrees of up to MaxLeafSize primitives into leaves if this lowers their SAH cost
+	Curve        SpaceFillingCurve // Order in which the primitives are sorted
+	AdaptiveBits bool              // Distribute the bits of Morton codes among the axes according to the extent of the enclosing box, instead of 21 bits per axis. Ignored for the Hilbert curve
+	Sort         SortAlgorithm     // Used to sort the primitives along the curve
+	Construction LBVHConstruction  // Used to build the tree from the sorted primitives
+}
+
+func DefaultLBVHOptions(threads int) LBVHOptions {
+	return LBVHOptions{
+		Threads:      threads,
+		MaxLeafSize:  DEFAULT_MAX_LEAF_SIZE,
+		MinLeafSize:  1,
+		CollapseSAH:  false,
+		Curve:        MortonCurve,
+		Sort:         BucketSortAlgorithm,
+		Construction: TopDownConstruction,
+	}
+}
+
+func LBVHWithOptions(prims []scene.Primitive, materials []scene.Material, enclosing scene.AABB, options LBVHOptions) *BVH {
+	if len(prims) == 0 {
+		return &BVH{primitives: prims, materials: materials}
+	}
+
+	threads := options.Threads
+	maxLeafSize := max(options.MaxLeafSize, 1)
+	minLeafSize := min(options.MinLeafSize, maxLeafSize)
+
+	encode := newCurveEncoder(enclosing, options.Curve, options.AdaptiveBits)
+	pairs := assignMortonCodes(prims, encode, threads)
+	sortMortonPairs(pairs, options.Sort, threads)
+	var root *node
+	if options.Construction == RadixTreeConstruction {
+		root = constructRadixTree(pairs, minLeafSize, maxLeafSize, threads)
+	} else {
+		root = constructLBVH(pairs, minLeafSize, maxLeafSize, threads)
+	}
 
 	tree := &BVH{
 		root:       root,
@@ -27,6 +93,9 @@ func LBVH(prims []scene.Primitive, materials []scene.Material, enclosing scene.A
 	}
 
 	tree.updateBounding(threads)
+	if options.CollapseSAH {
+		tree.root.collapseSAH(maxLeafSize)
+	}
 	return tree
 }
 
@@ -35,8 +104,8 @@ type mortonPair struct {
 	mortonCode uint64
 }
 
-// Iterates over all primitives in parallel and assigns morton codes
-func assignMortonCodes(prims []scene.Primitive, enclosing scene.AABB, threads int) []mortonPair {
+// Iterates over all primitives in parallel and assigns the codes of their centroids
+func assignMortonCodes(prims []scene.Primitive, encode curveEncoder, threads int) []mortonPair {
 	pairs := make([]mortonPair, len(prims))
 	batchSize := int(math.Ceil(float64(len(prims)) / float64(threads)))
 	wg := sync.WaitGroup{}
@@ -53,7 +122,7 @@ func assignMortonCodes(prims []scene.Primitive, enclosing scene.AABB, threads in
 		}
 		go func() {
 			for j := start; j < end; j++ {
-				code := computeMorton(prims[j], enclosing)
+				code := encode(prims[j].Bounding().Barycenter)
 				pairs[j] = mortonPair{
 					pId:        j,
 					mortonCode: code,
@@ -66,23 +135,61 @@ func assignMortonCodes(prims []scene.Primitive, enclosing scene.AABB, threads in
 	return pairs
 }
 
-// Computes a morton code according to the quantized primitive centroid
-func computeMorton(prim scene.Primitive, enclosing scene.AABB) uint64 {
-	center := prim.Bounding().Barycenter
-	deltaX := math.Abs(enclosing.Bounds[0].X - center.X)
-	deltaY := math.Abs(enclosing.Bounds[0].Y - center.Y)
-	deltaZ := math.Abs(enclosing.Bounds[0].Z - center.Z)
-	xQuantized := uint64(deltaX / (enclosing.Width / float64(morton.MORTON_SIZE-1)))
-	yQuantized := uint64(deltaY / (enclosing.Height / float64(morton.MORTON_SIZE-1)))
-	zQuantized := uint64(deltaZ / (enclosing.Depth / float64(morton.MORTON_SIZE-1)))
-	return morton.EncodeCompute(xQuantized, yQuantized, zQuantized)
+// Computes the position of a point inside the enclosing box along a space-filling curve, codes use at most 63 bits
+type curveEncoder func(point m.Vector3) uint64
+
+func newCurveEncoder(enclosing scene.AABB, curve SpaceFillingCurve, adaptiveBits bool) curveEncoder {
+	lo := enclosing.Bounds[0]
+	if curve == HilbertCurve {
+		return func(p m.Vector3) uint64 {
+			return morton.EncodeHilbert(
+				quantizeAxis(p.X, lo.X, enclosing.Width, morton.MORTON_SIZE),
+				quantizeAxis(p.Y, lo.Y, enclosing.Height, morton.MORTON_SIZE),
+				quantizeAxis(p.Z, lo.Z, enclosing.Depth, morton.MORTON_SIZE),
+			)
+		}
+	}
+
+	if adaptiveBits {
+		layout := morton.NewLayout(enclosing.Width, enclosing.Height, enclosing.Depth)
+		return func(p m.Vector3) uint64 {
+			return layout.Encode(
+				quantizeAxis(p.X, lo.X, enclosing.Width, 1<<layout.Bits[0]),
+				quantizeAxis(p.Y, lo.Y, enclosing.Height, 1<<layout.Bits[1]),
+				quantizeAxis(p.Z, lo.Z, enclosing.Depth, 1<<layout.Bits[2]),
+			)
+		}
+	}
+
+	return func(p m.Vector3) uint64 {
+		return morton.EncodeCompute(
+			quantizeAxis(p.X, lo.X, enclosing.Width, morton.MORTON_SIZE),
+			quantizeAxis(p.Y, lo.Y, enclosing.Height, morton.MORTON_SIZE),
+			quantizeAxis(p.Z, lo.Z, enclosing.Depth, morton.MORTON_SIZE),
+		)
+	}
+}
+
+// Maps v from [lo, lo + extent] to [0, size - 1]. Axes without extent, e.g. in planar scenes, map to 0
+func quantizeAxis(v, lo, extent float64, size uint64) uint64 {
+	if extent <= 0 || size <= 1 {
+		return 0
+	}
+	quantized := math.Abs(v-lo) / (extent / float64(size-1))
+	return uint64(math.Min(quantized, float64(size-1)))
 }
 
-func sortMortonPairs(pairs []mortonPair, threads int) {
+func sortMortonPairs(pairs []mortonPair, algorithm SortAlgorithm, threads int) {
+	if algorithm == RadixSortAlgorithm {
+		sort.RadixSort(pairs, func(pair mortonPair) uint64 { return pair.mortonCode }, 63, threads)
+		return
+	}
+
 	bucketSize := morton.MAX_MORTON_CODE / uint64(BUCKET_COUNT)
 
 	job := sort.SortJob[mortonPair]{
-		BucketIndex:     func(pair mortonPair) uint { return uint(pair.mortonCode / bucketSize) },
+		// Codes above MAX_MORTON_CODE, e.g. of a primitive in the maximum corner, belong to the last bucket
+		BucketIndex:     func(pair mortonPair) uint { return min(uint(pair.mortonCode/bucketSize), BUCKET_COUNT-1) },
 		Less:            func(a, b mortonPair) bool { return a.mortonCode < b.mortonCode },
 		Items:           pairs,
 		NumberOfBuckets: BUCKET_COUNT,
@@ -92,14 +199,16 @@ func sortMortonPairs(pairs []mortonPair, threads int) {
 }
 
 // Constructs BVH by inserting sorted morton primitive pairs into a binary radix tree
-func constructLBVH(pairs []mortonPair, mortonSize uint32, threads int) *node {
+func constructLBVH(pairs []mortonPair, minLeafSize, maxLeafSize int, threads int) *node {
 	var splitMask uint64 = 1 << 62
 
 	wg := sync.WaitGroup{}
 	wg.Add(len(pairs))
 	queue := lbvhWorkerQueue{
-		jobs: make(chan *lbvhJob, threads),
-		wg:   &wg,
+		jobs:        make(chan *lbvhJob, threads),
+		wg:          &wg,
+		minLeafSize: minLeafSize,
+		maxLeafSize: maxLeafSize,
 	}
 
 	// Start workers, each worker will find a split in its given interval and spawn 2 new jobs
@@ -135,8 +244,10 @@ type lbvhJob struct {
 }
 
 type lbvhWorkerQueue struct {
-	jobs chan *lbvhJob
-	wg   *sync.WaitGroup
+	jobs        chan *lbvhJob
+	wg          *sync.WaitGroup
+	minLeafSize int
+	maxLeafSize int
 }
 
 func (queue *lbvhWorkerQueue) add(job *lbvhJob) {
@@ -148,7 +259,7 @@ func (queue *lbvhWorkerQueue) add(job *lbvhJob) {
 }
 
 func (job *lbvhJob) process(queue *lbvhWorkerQueue) {
-	if isLeaf(job.pairs) {
+	if len(job.pairs) <= queue.minLeafSize || isLeaf(job.pairs) && len(job.pairs) <= queue.maxLeafSize {
 		indeces := make([]primitiveId, len(job.pairs))
 		queue.wg.Add(1)
 		for i, pair := range job.pairs {
@@ -161,8 +272,14 @@ func (job *lbvhJob) process(queue *lbvhWorkerQueue) {
 		return
 	}
 
-	// Find the split in the given interval where the most significant bit first changes
-	splitIndex := findSplit(job.pairs, job.splitMask)
+	// Find the split in the given interval where the most significant bit first changes.
+	// Equal codes have no such bit, so the interval is split in the middle instead
+	var splitIndex int
+	if isLeaf(job.pairs) {
+		splitIndex = len(job.pairs) / 2
+	} else {
+		splitIndex = findSplit(job.pairs, job.splitMask)
+	}
 
 	// If there is no split, only spawn one job, which makes pruning step afterwards obsolete and saves construction work
 	if splitIndex == 0 || splitIndex == len(job.pairs) {
@@ -218,3 +335,37 @@ func findSplit(pairs []mortonPair, splitMask uint64) int {
 	}
 	return len(pairs)
 }
+
+// Merges subtrees into leaves of at most maxLeafSize primitives, if the leaf is cheaper according to the SAH.
+// Children are collapsed first, so that larger subtrees are compared against their already collapsed form.
+// Returns the number of primitives in the subtree
+func (n *node) collapseSAH(maxLeafSize int) int {
+	if n.isLeaf {
+		return len(n.pIds)
+	}
+
+	n.size = 0
+	count := 0
+	for _, child := range n.children {
+		count += child.collapseSAH(maxLeafSize)
+	}
+	if count > maxLeafSize {
+		return count
+	}
+
+	// The subtree is small, so computing its cost is cheap
+	if sahIntersectionCost*float64(count) > n.costSAH(DefaultCostModel()) {
+		return count
+	}
+
+	leaves := make([]*node, 0, count)
+	n.collectLeaves(&leaves)
+	pIds := make([]primitiveId, 0, count)
+	for _, leaf := range leaves {
+		pIds = append(pIds, leaf.pIds...)
+	}
+	n.isLeaf = true
+	n.children = nil
+	n.pIds = pIds
+	return count
+}
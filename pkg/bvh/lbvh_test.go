@@ -1,20 +1,188 @@
 package bvh_test
 
 import (
+	"math"
+	"math/rand"
 	"runtime"
+	"strconv"
 	"testing"
 
 	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
 	"github.com/schmizzel/go-graphics/pkg/scene"
 	"github.com/stretchr/testify/require"
 )
 
 func TestLBVH(t *testing.T) {
-	mesh, err := scene.ParseFromPath("../../test/bunny.obj")
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
 	require.NoError(t, err)
 	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{Albedo: scene.NewColor(1, 0, 0)})
 	p, m := s.CollectPrimitives()
 	tree := bvh.DefaultLBVH(p, m, runtime.NumCPU())
+
+	// The tree does not depend on the number of threads, so its cost only changes with the construction
 	cost := int(tree.Cost(1, 1))
-	require.Equal(t, 39, cost)
+	require.Equal(t, 23, cost)
+	requireBruteForceHits(t, tree, p)
+}
+
+func TestLBVHValidate(t *testing.T) {
+	for name, p := range testInputs() {
+		t.Run(name, func(t *testing.T) {
+			tree := bvh.DefaultLBVH(p, make([]scene.Material, len(p)), runtime.NumCPU())
+			require.NoError(t, tree.Validate())
+			require.LessOrEqual(t, len(tree.Stats().LeafSizeHistogram), bvh.DEFAULT_MAX_LEAF_SIZE+1)
+		})
+	}
+
+	empty := bvh.DefaultLBVH([]scene.Primitive{}, []scene.Material{}, runtime.NumCPU())
+	require.NoError(t, empty.Validate())
+	require.Zero(t, empty.Stats().Nodes)
+	hit := scene.Hit{}
+	require.False(t, empty.ClosestHit(m.NewRay(m.NewVector3(0, 0, 1), m.NewVector3(0, 0, -1)), 0, math.Inf(1), &hit))
+}
+
+// Random triangles and degenerate inputs which are likely to break builders
+func testInputs() map[string][]scene.Primitive {
+	r := rand.New(rand.NewSource(0))
+	triangle := func(corner m.Vector3, size float64) scene.Primitive {
+		return scene.NewTriangleWithoutNormals(
+			corner,
+			corner.Add(m.NewRandomVector(0, size, r)),
+			corner.Add(m.NewRandomVector(0, size, r)),
+		)
+	}
+
+	inputs := map[string][]scene.Primitive{
+		"single": {triangle(m.NewVector3(0, 0, 0), 1)},
+
+		// The second centroid has the largest possible code
+		"corners": {
+			scene.NewTriangleWithoutNormals(m.NewVector3(0, 0, 0), m.NewVector3(0, 0, 0), m.NewVector3(0, 0, 0)),
+			scene.NewTriangleWithoutNormals(m.NewVector3(1, 1, 1), m.NewVector3(1, 1, 1), m.NewVector3(1, 1, 1)),
+		},
+	}
+	for _, n := range []int{2, 3, 1000} {
+		random := make([]scene.Primitive, n)
+		identical := make([]scene.Primitive, n)
+		planar := make([]scene.Primitive, n)
+		points := make([]scene.Primitive, n)
+		for i := 0; i < n; i++ {
+			random[i] = triangle(m.NewRandomVector(-10, 10, r), 1)
+			identical[i] = scene.NewTriangleWithoutNormals(m.NewVector3(0, 0, 0), m.NewVector3(1, 0, 0), m.NewVector3(0, 1, 0))
+
+			// All primitives lie in the plane z = 0, so the bounds have no depth
+			corner := m.NewVector3(r.Float64()*10, r.Float64()*10, 0)
+			planar[i] = scene.NewTriangleWithoutNormals(corner, corner.Add(m.NewVector3(1, 0, 0)), corner.Add(m.NewVector3(0, 1, 0)))
+
+			// Triangles collapsed to points along the x axis have no surface
+			point := m.NewVector3(float64(i), 0, 0)
+			points[i] = scene.NewTriangleWithoutNormals(point, point, point)
+		}
+		suffix := "-" + strconv.Itoa(n)
+		inputs["random"+suffix] = random
+		inputs["identical"+suffix] = identical
+		inputs["planar"+suffix] = planar
+		inputs["points"+suffix] = points
+	}
+	return inputs
+}
+
+func TestLBVHOptions(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	p, mat := s.CollectPrimitives()
+	enclosing := scene.EnclosingCentroids(p)
+
+	options := bvh.DefaultLBVHOptions(runtime.NumCPU())
+	reference := bvh.LBVHWithOptions(p, mat, enclosing, options)
+	require.Equal(t, bvh.DefaultLBVH(p, mat, runtime.NumCPU()).Cost(1, 1), reference.Cost(1, 1))
+
+	// Collapsing only merges subtrees if that is cheaper
+	options.CollapseSAH = true
+	collapsed := bvh.LBVHWithOptions(p, mat, enclosing, options)
+	require.NoError(t, collapsed.Validate())
+	require.Less(t, collapsed.Cost(1, 1), reference.Cost(1, 1))
+	require.Less(t, collapsed.Stats().Nodes, reference.Stats().Nodes)
+	require.LessOrEqual(t, len(collapsed.Stats().LeafSizeHistogram), options.MaxLeafSize+1)
+
+	// Radix sort orders primitives with equal codes differently, which does not affect the cost
+	options = bvh.DefaultLBVHOptions(runtime.NumCPU())
+	options.Sort = bvh.RadixSortAlgorithm
+	radix := bvh.LBVHWithOptions(p, mat, enclosing, options)
+	require.NoError(t, radix.Validate())
+	require.InDelta(t, reference.Cost(1, 1), radix.Cost(1, 1), 1e-9)
+
+	options = bvh.LBVHOptions{Threads: runtime.NumCPU(), MaxLeafSize: 8, MinLeafSize: 4}
+	grouped := bvh.LBVHWithOptions(p, mat, enclosing, options)
+	require.NoError(t, grouped.Validate())
+	require.Less(t, grouped.Stats().Leaves, reference.Stats().Leaves)
+	require.LessOrEqual(t, len(grouped.Stats().LeafSizeHistogram), options.MaxLeafSize+1)
+}
+
+func TestLBVHCurves(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	p, mat := s.CollectPrimitives()
+
+	// Stretched scene, for which 21 bits per axis waste precision on the short axes
+	flat := make([]scene.Primitive, len(p))
+	for i, prim := range p {
+		flat[i] = prim.Transformed(m.Scale(20, 1, 0.3))
+	}
+
+	for name, prims := range map[string][]scene.Primitive{"suzanne": p, "flat": flat} {
+		t.Run(name, func(t *testing.T) {
+			enclosing := scene.EnclosingCentroids(prims)
+			options := bvh.DefaultLBVHOptions(runtime.NumCPU())
+			reference := bvh.LBVHWithOptions(prims, mat, enclosing, options)
+
+			options.AdaptiveBits = true
+			adaptive := bvh.LBVHWithOptions(prims, mat, enclosing, options)
+			require.NoError(t, adaptive.Validate())
+			require.Less(t, adaptive.Cost(1, 1), reference.Cost(1, 1))
+
+			// Neighbouring Hilbert codes are always neighbouring cells, so the clusters are at least as tight as along the Morton curve
+			options = bvh.DefaultLBVHOptions(runtime.NumCPU())
+			options.Curve = bvh.HilbertCurve
+			hilbert := bvh.LBVHWithOptions(prims, mat, enclosing, options)
+			require.NoError(t, hilbert.Validate())
+			require.LessOrEqual(t, hilbert.Cost(1, 1), reference.Cost(1, 1))
+		})
+	}
+}
+
+func TestLBVHRadixTree(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	inputs := testInputs()
+	inputs["suzanne"], _ = s.CollectPrimitives()
+
+	for name, prims := range inputs {
+		t.Run(name, func(t *testing.T) {
+			for _, leafSizes := range [][2]int{{1, bvh.DEFAULT_MAX_LEAF_SIZE}, {4, 8}} {
+				options := bvh.DefaultLBVHOptions(runtime.NumCPU())
+				options.MinLeafSize, options.MaxLeafSize = leafSizes[0], leafSizes[1]
+				mat := make([]scene.Material, len(prims))
+				enclosing := scene.EnclosingCentroids(prims)
+				topDown := bvh.LBVHWithOptions(prims, mat, enclosing, options)
+
+				options.Construction = bvh.RadixTreeConstruction
+				radix := bvh.LBVHWithOptions(prims, mat, enclosing, options)
+				require.NoError(t, radix.Validate())
+				require.LessOrEqual(t, len(radix.Stats().LeafSizeHistogram), options.MaxLeafSize+1)
+
+				// Both build the same tree, unless runs of equal codes have to be split
+				if name == "suzanne" || name == "random-1000" {
+					expected, actual := topDown.Stats(), radix.Stats()
+					require.Equal(t, expected.DepthHistogram, actual.DepthHistogram)
+					require.Equal(t, expected.LeafSizeHistogram, actual.LeafSizeHistogram)
+					require.InDelta(t, expected.SAH, actual.SAH, 1e-9)
+				}
+			}
+		})
+	}
 }
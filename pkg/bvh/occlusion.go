@@ -0,0 +1,108 @@
+package bvh
+
+import (
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Decides whether a primitive is considered by a query, e.g. to let shadow rays pass through lights
+type PrimitiveFilter func(id int, material scene.Material) bool
+
+// Implemented by primitives that provide a cheaper test than a full intersection, e.g. triangles and instances.
+// Other primitives fall back to Intersected
+type occluder interface {
+	Occluded(ray m.Ray, tMin, tMax float64) bool
+}
+
+// Returns true if any primitive is hit between tMin and tMax.
+// Terminates on the first hit found, so it is cheaper than ClosestHit for shadow and occlusion rays.
+func (bvh *BVH) Occluded(ray m.Ray, tMin, tMax float64) bool {
+	return bvh.OccludedFiltered(ray, tMin, tMax, nil)
+}
+
+// Same as Occluded, but primitives for which the filter returns false are ignored. A nil filter accepts all primitives
+func (bvh *BVH) OccludedFiltered(ray m.Ray, tMin, tMax float64, filter PrimitiveFilter) bool {
+	if bvh.root == nil {
+		return false
+	}
+
+	hit := scene.Hit{}
+	return bvh.root.occluded(ray, bvh, tMin, tMax, filter, &hit)
+}
+
+// Children are visited in order, since any hit terminates the query
+func (n *node) occluded(ray m.Ray, bvh *BVH, tMin, tMax float64, filter PrimitiveFilter, hit *scene.Hit) bool {
+	if !n.aabb.Intersected(ray, tMin, tMax) {
+		return false
+	}
+
+	if n.isLeaf {
+		for _, pId := range n.pIds {
+			if filter != nil && !filter(pId, bvh.materials[pId]) {
+				continue
+			}
+			if primitiveOccludes(bvh.primitives[pId], ray, tMin, tMax, hit) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, child := range n.children {
+		if child.occluded(ray, bvh, tMin, tMax, filter, hit) {
+			return true
+		}
+	}
+	return false
+}
+
+func primitiveOccludes(p scene.Primitive, ray m.Ray, tMin, tMax float64, hit *scene.Hit) bool {
+	if o, ok := p.(occluder); ok {
+		return o.Occluded(ray, tMin, tMax)
+	}
+	return p.Intersected(ray, tMin, tMax, hit)
+}
+
+func (flat *FlatBVH) Occluded(ray m.Ray, tMin, tMax float64) bool {
+	return flat.OccludedFiltered(ray, tMin, tMax, nil)
+}
+
+// The filter receives the ids of the primitives in the tree that was flattened, not their positions in the flat layout
+func (flat *FlatBVH) OccludedFiltered(ray m.Ray, tMin, tMax float64, filter PrimitiveFilter) bool {
+	if len(flat.nodes) == 0 {
+		return false
+	}
+
+	hit := scene.Hit{}
+	stack := make([]int32, 1, 64)
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		n := &flat.nodes[i]
+		if !scene.BoundsIntersected(&n.bounds, ray, tMin, tMax) {
+			continue
+		}
+
+		for j := n.offset; j < n.offset+n.count; j++ {
+			if filter != nil && !filter(flat.ids[j], flat.materials[j]) {
+				continue
+			}
+			if primitiveOccludes(flat.primitives[j], ray, tMin, tMax, &hit) {
+				return true
+			}
+		}
+
+		child := i + 1
+		for c := int32(0); c < n.children; c++ {
+			stack = append(stack, child)
+			child = flat.nodes[child].skip
+		}
+	}
+
+	return false
+}
+
+func (inst *Instance) Occluded(ray m.Ray, tMin, tMax float64) bool {
+	return inst.Tree.Occluded(inst.toObjectSpace(ray), tMin, tMax)
+}
@@ -0,0 +1,72 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOccluded(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	root := scene.NewNode()
+	root.AddChild(scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{}))
+	root.AddChild(scene.NewNode().SetMesh(mesh).SetMaterial(scene.Light{}).Translate(2, 0, 0))
+	p, mat := root.CollectPrimitives()
+
+	build := func(p []scene.Primitive, mat []scene.Material) *bvh.BVH {
+		return bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	}
+	tree := build(p, mat)
+	trees := map[string]bvh.Traversable{
+		"lbvh":      tree,
+		"flat":      tree.Flatten(),
+		"instanced": bvh.BuildInstanced(root, build),
+	}
+
+	for name, traversable := range trees {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(0))
+			occluded := 0
+			for i := 0; i < 1000; i++ {
+				origin := m.NewRandomVector(-3, 5, r)
+				ray := m.NewRay(origin, m.NewRandomVector(-1, 3, r).Sub(origin))
+				tMax := r.Float64()
+
+				hit := scene.Hit{}
+				expected := tree.ClosestHit(ray, 0.001, tMax, &hit)
+				require.Equal(t, expected, traversable.Occluded(ray, 0.001, tMax))
+				if expected {
+					occluded++
+				}
+			}
+			require.Greater(t, occluded, 50)
+		})
+	}
+
+	// Shadow rays towards the light only hit the light
+	ray := m.NewRay(m.NewVector3(2, 0, 5), m.NewVector3(0, 0, -1))
+	require.True(t, tree.Occluded(ray, 0.001, math.Inf(1)))
+	ignoreLights := func(id int, material scene.Material) bool {
+		_, light := material.(scene.Light)
+		return !light
+	}
+	require.False(t, tree.OccludedFiltered(ray, 0.001, math.Inf(1), ignoreLights))
+	require.False(t, tree.Flatten().OccludedFiltered(ray, 0.001, math.Inf(1), ignoreLights))
+
+	// Ids passed to the filter are the same for the tree and the flat layout
+	ignoreSecond := func(id int, _ scene.Material) bool {
+		return id < len(p)/2
+	}
+	require.False(t, tree.OccludedFiltered(ray, 0.001, math.Inf(1), ignoreSecond))
+	require.False(t, tree.Flatten().OccludedFiltered(ray, 0.001, math.Inf(1), ignoreSecond))
+	ray = m.NewRay(m.NewVector3(0, 0, 5), m.NewVector3(0, 0, -1))
+	require.True(t, tree.OccludedFiltered(ray, 0.001, math.Inf(1), ignoreSecond))
+	require.True(t, tree.Flatten().OccludedFiltered(ray, 0.001, math.Inf(1), ignoreSecond))
+}
@@ -0,0 +1,171 @@
+package bvh
+
+import (
+	"math"
+
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+const MAX_PACKET_SIZE = 64 // Hits are reported as a bit mask, e.g. for 8x8 tiles
+
+// Implemented by acceleration structures that can trace coherent rays together
+type PacketTraversable interface {
+	Traversable
+	ClosestHitPacket(packet *RayPacket, tMin, tMax float64, hitsOut []scene.Hit) uint64
+}
+
+// Group of coherent rays, e.g. the primary rays of a small image tile.
+// If all rays share their origin and the signs of their directions, whole subtrees can be culled for the packet
+// with a single interval arithmetic test on the bounds of the inverse directions.
+type RayPacket struct {
+	rays []m.Ray
+
+	coherent bool
+	origin   m.Vector3
+	sign     [3]int
+	invMin   m.Vector3
+	invMax   m.Vector3
+}
+
+// The packet references the given rays, which must not be modified while it is in use
+func NewRayPacket(rays []m.Ray) RayPacket {
+	if len(rays) > MAX_PACKET_SIZE {
+		panic("ray packet exceeds MAX_PACKET_SIZE")
+	}
+
+	packet := RayPacket{rays: rays, coherent: len(rays) > 0}
+	if !packet.coherent {
+		return packet
+	}
+
+	packet.origin = rays[0].Origin
+	packet.sign = rays[0].Sign
+	packet.invMin = rays[0].InvDirection
+	packet.invMax = rays[0].InvDirection
+	for _, ray := range rays {
+		if ray.Origin != packet.origin || ray.Sign != packet.sign {
+			packet.coherent = false
+			return packet
+		}
+		packet.invMin = m.MinVec(packet.invMin, ray.InvDirection)
+		packet.invMax = m.MaxVec(packet.invMax, ray.InvDirection)
+	}
+
+	// Axis parallel rays have infinite inverse directions, which break the interval arithmetic
+	for axis := 0; axis < 3; axis++ {
+		if math.IsInf(packet.invMin.Component(axis), 0) || math.IsInf(packet.invMax.Component(axis), 0) {
+			packet.coherent = false
+		}
+	}
+	return packet
+}
+
+func (p *RayPacket) Len() int {
+	return len(p.rays)
+}
+
+// Conservative test whether any ray of the packet may intersect the box
+func (p *RayPacket) mayIntersect(box *scene.AABB, tMin float64) bool {
+	near := tMin
+	far := math.Inf(1)
+	for axis := 0; axis < 3; axis++ {
+		o := p.origin.Component(axis)
+		lo := box.Bounds[p.sign[axis]].Component(axis) - o
+		hi := box.Bounds[1-p.sign[axis]].Component(axis) - o
+		invMin := p.invMin.Component(axis)
+		invMax := p.invMax.Component(axis)
+
+		// Smallest entry and largest exit distance of all inverse directions in the interval
+		near = math.Max(near, math.Min(lo*invMin, lo*invMax))
+		far = math.Min(far, math.Max(hi*invMin, hi*invMax))
+	}
+	return near <= far
+}
+
+// Traces all rays of the packet and stores their closest hits in hitsOut.
+// Bit i of the returned mask is set if ray i hit a primitive.
+func (bvh *BVH) ClosestHitPacket(packet *RayPacket, tMin, tMax float64, hitsOut []scene.Hit) uint64 {
+	if bvh.root == nil || packet.Len() == 0 {
+		return 0
+	}
+
+	for i := range packet.rays {
+		hitsOut[i].T = tMax
+	}
+
+	q := packetQuery{packet: packet, tMin: tMin, hits: hitsOut[:packet.Len()], bvh: bvh}
+	q.traverse(bvh.root, 0)
+	return q.mask
+}
+
+type packetQuery struct {
+	packet *RayPacket
+	tMin   float64
+	hits   []scene.Hit
+	mask   uint64
+	bvh    *BVH
+}
+
+// Returns the index of the first ray at or after first that intersects the box, or -1 if no ray does
+func (q *packetQuery) firstActive(box *scene.AABB, first int) int {
+	rays := q.packet.rays
+	if box.Intersected(rays[first], q.tMin, q.hits[first].T) {
+		return first
+	}
+	if q.packet.coherent && !q.packet.mayIntersect(box, q.tMin) {
+		return -1
+	}
+
+	for i := first + 1; i < len(rays); i++ {
+		if box.Intersected(rays[i], q.tMin, q.hits[i].T) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rays before first are known to miss the node and are skipped for the whole subtree
+func (q *packetQuery) traverse(n *node, first int) {
+	first = q.firstActive(&n.aabb, first)
+	if first < 0 {
+		return
+	}
+
+	if n.isLeaf {
+		for i := first; i < len(q.packet.rays); i++ {
+			ray := q.packet.rays[i]
+			if i > first && !n.aabb.Intersected(ray, q.tMin, q.hits[i].T) {
+				continue
+			}
+
+			for _, pId := range n.pIds {
+				if q.bvh.primitives[pId].Intersected(ray, q.tMin, q.hits[i].T, &q.hits[i]) {
+					q.hits[i].Material = q.bvh.materials[pId]
+					q.mask |= 1 << i
+				}
+			}
+		}
+		return
+	}
+
+	// Children are ordered by the origin of the first active ray, which is representative for coherent rays
+	origin := q.packet.rays[first].Origin
+	if len(n.children) == 2 {
+		distA := n.children[0].aabb.Barycenter.Distance(origin)
+		distB := n.children[1].aabb.Barycenter.Distance(origin)
+		if distA < distB {
+			q.traverse(n.children[0], first)
+			q.traverse(n.children[1], first)
+		} else {
+			q.traverse(n.children[1], first)
+			q.traverse(n.children[0], first)
+		}
+		return
+	}
+
+	var buf [8]childDistance[*node]
+	for _, c := range n.childrenByDistance(origin, buf[:]) {
+		q.traverse(c.child, first)
+	}
+}
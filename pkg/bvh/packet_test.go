@@ -0,0 +1,70 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClosestHitPacket(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{Albedo: scene.NewColor(1, 0, 0)})
+	p, mat := s.CollectPrimitives()
+
+	phr := bvh.NewPHRBuilder(0.5, 6, 4, runtime.NumCPU())
+	trees := map[string]*bvh.BVH{
+		"lbvh":  bvh.DefaultLBVH(p, mat, runtime.NumCPU()),
+		"phr-4": phr.BuildFromLBVH(p, mat),
+	}
+
+	// Coherent packets share their origin like primary rays, incoherent packets have random origins
+	r := rand.New(rand.NewSource(0))
+	var packets [][]m.Ray
+	for i := 0; i < 50; i++ {
+		origin := m.NewRandomVector(-3, 3, r).WithComponent(2, 4)
+		target := m.NewRandomVector(-1, 1, r)
+		coherent := make([]m.Ray, 0, 64)
+		incoherent := make([]m.Ray, 0, 16)
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				offset := m.NewVector3(float64(x), float64(y), 0).Mul(0.05)
+				coherent = append(coherent, m.NewRay(origin, target.Add(offset).Sub(origin)))
+			}
+		}
+		for j := 0; j < 16; j++ {
+			o := m.NewRandomVector(-3, 3, r)
+			incoherent = append(incoherent, m.NewRay(o, m.NewRandomVector(-1, 1, r).Sub(o)))
+		}
+		packets = append(packets, coherent, incoherent)
+	}
+
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			hits := make([]scene.Hit, bvh.MAX_PACKET_SIZE)
+			total := 0
+			for _, rays := range packets {
+				packet := bvh.NewRayPacket(rays)
+				mask := tree.ClosestHitPacket(&packet, 0.001, math.Inf(1), hits)
+
+				for i, ray := range rays {
+					expected := scene.Hit{}
+					ok := tree.ClosestHit(ray, 0.001, math.Inf(1), &expected)
+					require.Equal(t, ok, mask&(1<<i) != 0)
+					if ok {
+						total++
+						require.Equal(t, expected.T, hits[i].T)
+						require.Equal(t, expected.Material, hits[i].Material)
+					}
+				}
+			}
+			require.Greater(t, total, 100)
+		})
+	}
+}
@@ -18,6 +18,8 @@ type PhrBuilder struct {
 	BranchingFactor int
 	Threshold       AreaThreshold
 	Split           SplitFunction
+	Cost            CostModel // Passed to the SplitFunction. Ignores traversals by default, which splits more often and results in cheaper trees
+	MaxLeafSize     int       // Cuts that are not split by the SplitFunction are split by count if they contain more primitives
 
 	jobs           chan phrJob
 	threadCount    int
@@ -36,6 +38,8 @@ func NewPHRBuilder(alpha float64, delta float64, branchingFactor int, threadCoun
 		BranchingFactor: branchingFactor,
 		Threshold:       DefaultThreshold,
 		Split:           SweepSAH,
+		Cost:            CostModel{Traversal: 0, Intersection: sahIntersectionCost},
+		MaxLeafSize:     DEFAULT_MAX_LEAF_SIZE,
 		threadCount:     threadCount,
 	}
 }
@@ -53,11 +57,15 @@ func (b *PhrBuilder) SetHQMode() {
 }
 
 func (builder *PhrBuilder) BuildFromLBVH(p []scene.Primitive, m []scene.Material) *BVH {
-	bvh := LBVH(p, m, scene.EnclosingAABB(p), builder.threadCount)
+	bvh := DefaultLBVH(p, m, builder.threadCount)
 	return builder.Refine(bvh)
 }
 
 func (p *PhrBuilder) Refine(bvh *BVH) *BVH {
+	if bvh.root == nil {
+		return bvh
+	}
+
 	p.surface = bvh.root.aabb.Surface()
 	p.initialCutSize = 0
 
@@ -93,7 +101,7 @@ func (p *PhrBuilder) Refine(bvh *BVH) *BVH {
 }
 
 type phrJob struct {
-	cut        phrCut
+	cut        Cut
 	parent     *node
 	childIndex int
 }
@@ -104,7 +112,7 @@ func (p *PhrBuilder) buildSubTree(job phrJob, wg *sync.WaitGroup) {
 		wg.Done()
 		return
 	}
-	cuts := make([]phrCut, 1, p.BranchingFactor)
+	cuts := make([]Cut, 1, p.BranchingFactor)
 	cuts[0] = job.cut
 
 	// Keep splitting cut until enough nodes to branch the tree are found
@@ -125,18 +133,30 @@ func (p *PhrBuilder) buildSubTree(job phrJob, wg *sync.WaitGroup) {
 		}
 
 		// Split biggest cut
-		left, right := p.Split(cuts[maxI])
+		left, right := p.Split(cuts[maxI], p.Cost)
 		if right != nil {
 			cuts[maxI] = p.refined(*left)
 			cuts = append(cuts, p.refined(*right))
-		} else {
+		} else if leaf := makeLeaf(left.bounding, left.nodes...); len(leaf.pIds) <= p.MaxLeafSize {
 			// If cut was not split, make it a leaf node
-			cuts[maxI] = phrCut{
-				nodes: []*node{makeLeaf(left.bounding, left.nodes...)},
+			cuts[maxI] = Cut{
+				nodes: []*node{leaf},
 			}
+		} else {
+			// Too many primitives for a leaf, e.g. if all nodes have the same bounds => split by count
+			half := len(left.nodes) / 2
+			cuts[maxI] = p.refined(newCut(left.nodes[:half], left.depth))
+			cuts = append(cuts, p.refined(newCut(left.nodes[half:], left.depth)))
 		}
 	}
 
+	// The whole cut was turned into a leaf
+	if len(cuts) == 1 {
+		job.parent.addChild(cuts[0].nodes[0], job.childIndex)
+		wg.Done()
+		return
+	}
+
 	wg.Add(len(cuts) - 1)
 
 	// Create a new BVH branch
@@ -162,9 +182,9 @@ func (p *PhrBuilder) buildSubTree(job phrJob, wg *sync.WaitGroup) {
 	}
 }
 
-func (p *PhrBuilder) findInitialCut(auxilary *BVH, threadCount int) phrCut {
+func (p *PhrBuilder) findInitialCut(auxilary *BVH, threadCount int) Cut {
 	queue := make(chan *node, 1024)
-	cut := phrCut{
+	cut := Cut{
 		bounding: auxilary.root.aabb,
 		depth:    1,
 	}
@@ -217,7 +237,7 @@ func (p *PhrBuilder) processNodeInitialCut(node *node, wg *sync.WaitGroup, m *sy
 	}
 }
 
-func (p *PhrBuilder) refined(cut phrCut) phrCut {
+func (p *PhrBuilder) refined(cut Cut) Cut {
 	refinedCut := make([]*node, 0, len(cut.nodes))
 	for _, node := range cut.nodes {
 		if node.isLeaf {
@@ -233,11 +253,14 @@ func (p *PhrBuilder) refined(cut phrCut) phrCut {
 		}
 	}
 
+	// A single node is collapsed into a leaf, unless its subtree has too many primitives
 	if len(refinedCut) == 1 {
-		refinedCut[0] = makeLeaf(cut.bounding, refinedCut...)
+		if leaf := makeLeaf(cut.bounding, refinedCut...); len(leaf.pIds) <= p.MaxLeafSize {
+			refinedCut[0] = leaf
+		}
 	}
 
-	return phrCut{
+	return Cut{
 		nodes:    refinedCut,
 		bounding: cut.bounding,
 		depth:    cut.depth + 1,
@@ -264,15 +287,80 @@ func DefaultThreshold(surface float64, alpha float64, delta float64, depth int)
 	return surface / math.Pow(2, alpha*float64(depth)+float64(delta))
 }
 
-type phrCut struct {
+// Nodes of the auxiliary BVH that become descendants of the same node in the refined BVH.
+// A SplitFunction partitions them into the cuts of the children
+type Cut struct {
 	nodes    []*node
 	bounding scene.AABB
 	depth    int
 }
 
-type SplitFunction func(phrCut) (*phrCut, *phrCut)
+func newCut(nodes []*node, depth int) Cut {
+	bounding := nodes[0].aabb
+	for _, n := range nodes[1:] {
+		bounding = bounding.Add(n.aabb)
+	}
+	return Cut{
+		nodes:    nodes,
+		bounding: bounding,
+		depth:    depth,
+	}
+}
+
+func (c Cut) Len() int {
+	return len(c.nodes)
+}
+
+func (c Cut) Bounding() scene.AABB {
+	return c.bounding
+}
+
+// Depth of the node built from the cut in the refined BVH
+func (c Cut) Depth() int {
+	return c.depth
+}
 
-func SweepSAH(cut phrCut) (l *phrCut, r *phrCut) {
+func (c Cut) NodeBounding(i int) scene.AABB {
+	return c.nodes[i].aabb
+}
+
+// Number of nodes in the auxiliary subtree of the i-th node, used by the built-in splitters as its cost
+func (c Cut) NodeSize(i int) int {
+	return c.nodes[i].subtreeSize()
+}
+
+// Stable sorts the nodes in place by their bounding boxes
+func (c Cut) Sort(less func(a, b scene.AABB) bool) {
+	sort.SliceStable(c.nodes, func(i, j int) bool {
+		return less(c.nodes[i].aabb, c.nodes[j].aabb)
+	})
+}
+
+// Splits the cut into the nodes before and from index i, which has to be in (0, Len())
+func (c Cut) SplitAt(i int) (*Cut, *Cut) {
+	left := newCut(c.nodes[:i], c.depth)
+	right := newCut(c.nodes[i:], c.depth)
+	return &left, &right
+}
+
+// Splits the cut into two non-empty cuts. Returns the unchanged cut and nil if the nodes should not be split,
+// which turns them into a leaf unless they contain more than MaxLeafSize primitives
+type SplitFunction func(cut Cut, cost CostModel) (*Cut, *Cut)
+
+// Sorts the nodes by their centroids along each axis and returns the split with the lowest SAH
+func SweepSAH(cut Cut, cost CostModel) (*Cut, *Cut) {
+	return sweepSAH(cut, cost, 0)
+}
+
+// Like SweepSAH, but overlapping children are penalized by overlapWeight times the cost of intersecting all their
+// nodes inside the overlap. Approximates the end-point overlap, which cannot be computed from the bounding boxes alone
+func EPOSAH(overlapWeight float64) SplitFunction {
+	return func(cut Cut, cost CostModel) (*Cut, *Cut) {
+		return sweepSAH(cut, cost, overlapWeight)
+	}
+}
+
+func sweepSAH(cut Cut, cost CostModel, overlapWeight float64) (l *Cut, r *Cut) {
 	// Sort along x and y axis using two separate slices
 	sort.SliceStable(cut.nodes, func(i, j int) bool {
 		return cut.nodes[i].aabb.Barycenter.X < cut.nodes[j].aabb.Barycenter.X
@@ -283,8 +371,8 @@ func SweepSAH(cut phrCut) (l *phrCut, r *phrCut) {
 		return sorted2[i].aabb.Barycenter.Y < sorted2[j].aabb.Barycenter.Y
 	})
 
-	xSAH := minCost(cut.nodes, cut.bounding, cut.depth)
-	ySAH := minCost(sorted2, cut.bounding, cut.depth)
+	xSAH := minCost(cut.nodes, cut.bounding, cut.depth, cost, overlapWeight)
+	ySAH := minCost(sorted2, cut.bounding, cut.depth, cost, overlapWeight)
 	// Keep the sorted slice with lower cost and override the other by sorting along z axis
 	// Finally, return the split with the lowest cost
 
@@ -292,7 +380,7 @@ func SweepSAH(cut phrCut) (l *phrCut, r *phrCut) {
 		sort.SliceStable(sorted2, func(i, j int) bool {
 			return sorted2[i].aabb.Barycenter.Z < sorted2[j].aabb.Barycenter.Z
 		})
-		zSAH := minCost(sorted2, cut.bounding, cut.depth)
+		zSAH := minCost(sorted2, cut.bounding, cut.depth, cost, overlapWeight)
 		if xSAH.cost < zSAH.cost {
 			return xSAH.left, xSAH.right
 		} else {
@@ -302,7 +390,7 @@ func SweepSAH(cut phrCut) (l *phrCut, r *phrCut) {
 		sort.SliceStable(cut.nodes, func(i, j int) bool {
 			return cut.nodes[i].aabb.Barycenter.Z < cut.nodes[j].aabb.Barycenter.Z
 		})
-		zSAH := minCost(cut.nodes, cut.bounding, cut.depth)
+		zSAH := minCost(cut.nodes, cut.bounding, cut.depth, cost, overlapWeight)
 		if ySAH.cost < zSAH.cost {
 			return ySAH.left, ySAH.right
 		} else {
@@ -312,23 +400,25 @@ func SweepSAH(cut phrCut) (l *phrCut, r *phrCut) {
 }
 
 type sah struct {
-	left  *phrCut
-	right *phrCut
+	left  *Cut
+	right *Cut
 	cost  float64
 }
 
 // Uses SAH to compute the best split
-func minCost(sortedNodes []*node, bounding scene.AABB, depth int) sah {
+func minCost(sortedNodes []*node, bounding scene.AABB, depth int, c CostModel, overlapWeight float64) sah {
 	// Compute and track right costs by incrementally extending bounding box
 	SaRight := sortedNodes[len(sortedNodes)-1].aabb
 	rightCosts := make([]float64, len(sortedNodes))
-	rightCuts := make([]phrCut, len(sortedNodes))
+	rightCounts := make([]int, len(sortedNodes))
+	rightCuts := make([]Cut, len(sortedNodes))
 	nodeCount := 0
 	for i := len(sortedNodes) - 1; i > 0; i-- {
 		SaRight = SaRight.Add(sortedNodes[i].aabb)
 		nodeCount += sortedNodes[i].subtreeSize()
-		rightCosts[i] = SaRight.Surface() * float64(nodeCount)
-		rightCuts[i] = phrCut{
+		rightCosts[i] = c.Leaf(SaRight.Surface(), nodeCount)
+		rightCounts[i] = nodeCount
+		rightCuts[i] = Cut{
 			nodes:    sortedNodes[i:],
 			bounding: SaRight,
 			depth:    depth,
@@ -337,8 +427,8 @@ func minCost(sortedNodes []*node, bounding scene.AABB, depth int) sah {
 
 	nodeCount += sortedNodes[0].subtreeSize()
 	min := sah{
-		cost: bounding.Surface() * float64(nodeCount),
-		left: &phrCut{
+		cost: c.Leaf(bounding.Surface(), nodeCount),
+		left: &Cut{
 			nodes:    sortedNodes,
 			bounding: bounding,
 			depth:    depth,
@@ -349,10 +439,15 @@ func minCost(sortedNodes []*node, bounding scene.AABB, depth int) sah {
 	nodeCount = sortedNodes[0].subtreeSize()
 	SaLeft := sortedNodes[0].aabb
 	for i := 1; i < len(sortedNodes); i++ {
-		cost := rightCosts[i] + SaLeft.Surface()*float64(nodeCount)
+		cost := c.Traversal*bounding.Surface() + rightCosts[i] + c.Leaf(SaLeft.Surface(), nodeCount)
+		if overlapWeight > 0 {
+			if overlap, ok := SaLeft.Intersect(rightCuts[i].bounding); ok {
+				cost += overlapWeight * c.Leaf(overlap.Surface(), nodeCount+rightCounts[i])
+			}
+		}
 		if cost < min.cost {
 			min.cost = cost
-			min.left = &phrCut{
+			min.left = &Cut{
 				nodes:    sortedNodes[:i],
 				bounding: SaLeft,
 				depth:    depth,
@@ -0,0 +1,101 @@
+package bvh
+
+import (
+	"sort"
+
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Evaluates the SAH on a fixed number of centroid bins along each axis instead of every node position,
+// which is faster than SweepSAH for large cuts
+func BinnedSAH(bins int) SplitFunction {
+	return func(cut Cut, cost CostModel) (*Cut, *Cut) {
+		if len(cut.nodes) < 2 {
+			return &cut, nil
+		}
+
+		count := 0
+		for _, n := range cut.nodes {
+			count += n.subtreeSize()
+		}
+		centroids := cut.centroids()
+		box := func(i int) scene.AABB { return cut.nodes[i].aabb }
+		weight := func(i int) int { return cut.nodes[i].subtreeSize() }
+		split := findObjectSplit(len(cut.nodes), box, weight, cut.bounding, centroids, bins, cost)
+		if split.axis < 0 || split.cost >= cost.Leaf(cut.bounding.Surface(), count) {
+			return &cut, nil
+		}
+
+		lo := centroids.Bounds[0].Component(split.axis)
+		extent := centroids.Bounds[1].Component(split.axis) - lo
+		i := 0
+		j := len(cut.nodes) - 1
+		for i <= j {
+			if binIndex(cut.nodes[i].aabb.Barycenter, split.axis, lo, extent, bins) < split.bin {
+				i++
+			} else {
+				cut.nodes[i], cut.nodes[j] = cut.nodes[j], cut.nodes[i]
+				j--
+			}
+		}
+		return cut.SplitAt(i)
+	}
+}
+
+// Splits the nodes in half along the longest axis of their centroids. Never turns a cut into a leaf
+func MedianSplit(cut Cut, _ CostModel) (*Cut, *Cut) {
+	if len(cut.nodes) < 2 {
+		return &cut, nil
+	}
+
+	axis := longestAxis(cut.centroids())
+	cut.Sort(func(a, b scene.AABB) bool {
+		return a.Barycenter.Component(axis) < b.Barycenter.Component(axis)
+	})
+	return cut.SplitAt(len(cut.nodes) / 2)
+}
+
+// Splits the nodes at the center of their centroids along the longest axis, or at the median if all centroids lie on
+// one side. Never turns a cut into a leaf
+func LongestAxisSplit(cut Cut, _ CostModel) (*Cut, *Cut) {
+	if len(cut.nodes) < 2 {
+		return &cut, nil
+	}
+
+	centroids := cut.centroids()
+	axis := longestAxis(centroids)
+	center := centroids.Barycenter.Component(axis)
+	cut.Sort(func(a, b scene.AABB) bool {
+		return a.Barycenter.Component(axis) < b.Barycenter.Component(axis)
+	})
+	i := sort.Search(len(cut.nodes), func(i int) bool {
+		return cut.nodes[i].aabb.Barycenter.Component(axis) >= center
+	})
+	if i == 0 || i == len(cut.nodes) {
+		return cut.SplitAt(len(cut.nodes) / 2)
+	}
+	return cut.SplitAt(i)
+}
+
+// Bounds of the centers of the node boxes
+func (c Cut) centroids() scene.AABB {
+	min := c.nodes[0].aabb.Barycenter
+	max := min
+	for _, n := range c.nodes[1:] {
+		min = m.MinVec(min, n.aabb.Barycenter)
+		max = m.MaxVec(max, n.aabb.Barycenter)
+	}
+	return scene.NewAABB(min, max)
+}
+
+func longestAxis(box scene.AABB) int {
+	size := box.Size()
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if size.Component(i) > size.Component(axis) {
+			axis = i
+		}
+	}
+	return axis
+}
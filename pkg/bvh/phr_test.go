@@ -0,0 +1,71 @@
+package bvh_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPHRValidate(t *testing.T) {
+	for name, p := range testInputs() {
+		t.Run(name, func(t *testing.T) {
+			mat := make([]scene.Material, len(p))
+			for _, branchingFactor := range []int{2, 4} {
+				phr := bvh.NewPHRBuilder(0.5, 6, branchingFactor, runtime.NumCPU())
+				tree := phr.Refine(bvh.DefaultLBVH(p, mat, runtime.NumCPU()))
+				require.NoError(t, tree.Validate())
+				require.LessOrEqual(t, len(tree.Stats().LeafSizeHistogram), phr.MaxLeafSize+1)
+			}
+		})
+	}
+
+	phr := bvh.NewDefaultPHRBuilder()
+	empty := phr.BuildFromLBVH([]scene.Primitive{}, []scene.Material{})
+	require.NoError(t, empty.Validate())
+	require.Zero(t, empty.Cost(1, 1))
+}
+
+func TestPHRSplitters(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	inputs := testInputs()
+	inputs["suzanne"], _ = s.CollectPrimitives()
+
+	// Splits along x at the center of the cut, which only needs the exported cut API
+	custom := func(cut bvh.Cut, _ bvh.CostModel) (*bvh.Cut, *bvh.Cut) {
+		cut.Sort(func(a, b scene.AABB) bool { return a.Barycenter.X < b.Barycenter.X })
+		return cut.SplitAt(cut.Len() / 2)
+	}
+
+	splitters := map[string]bvh.SplitFunction{
+		"sweep":   bvh.SweepSAH,
+		"binned":  bvh.BinnedSAH(bvh.DEFAULT_SAH_BINS),
+		"epo":     bvh.EPOSAH(1),
+		"median":  bvh.MedianSplit,
+		"longest": bvh.LongestAxisSplit,
+		"custom":  custom,
+	}
+
+	for name, p := range inputs {
+		mat := make([]scene.Material, len(p))
+		lbvh := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+		for splitName, split := range splitters {
+			t.Run(name+"/"+splitName, func(t *testing.T) {
+				phr := bvh.NewPHRBuilder(0.55, 9, 2, runtime.NumCPU())
+				phr.Split = split
+				tree := phr.BuildFromLBVH(p, mat)
+				require.NoError(t, tree.Validate())
+				require.LessOrEqual(t, len(tree.Stats().LeafSizeHistogram), phr.MaxLeafSize+1)
+
+				// The SAH based splitters improve the LBVH
+				if name == "suzanne" && (splitName == "sweep" || splitName == "binned" || splitName == "epo") {
+					require.Less(t, tree.Cost(1, 1), lbvh.Cost(1, 1))
+				}
+			})
+		}
+	}
+}
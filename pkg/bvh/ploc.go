@@ -0,0 +1,150 @@
+package bvh
+
+import (
+	"math"
+	"runtime"
+
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+const (
+	DEFAULT_PLOC_RADIUS   = 16
+	DEFAULT_PLOC_CLUSTERS = 1
+)
+
+// Bottom-up builder implementing parallel locally-ordered clustering (Meister and Bittner 2018).
+// Primitives are sorted along the Morton curve, afterwards clusters are repeatedly merged with their nearest
+// neighbour, searched within a small window of the sorted cluster list, until a single cluster remains.
+type PLOCBuilder struct {
+	Radius      int // Number of clusters searched on either side for the nearest neighbour
+	Clusters    int // Once at most this many clusters remain, the nearest neighbour is searched among all of them, which improves the top levels of the tree
+	MaxLeafSize int // Primitives with equal Morton codes are grouped into initial clusters of up to this size
+
+	threadCount int
+}
+
+func NewDefaultPLOCBuilder() PLOCBuilder {
+	return NewPLOCBuilder(DEFAULT_PLOC_RADIUS, DEFAULT_PLOC_CLUSTERS, DEFAULT_MAX_LEAF_SIZE, runtime.GOMAXPROCS(0))
+}
+
+func NewPLOCBuilder(radius int, clusters int, maxLeafSize int, threadCount int) PLOCBuilder {
+	return PLOCBuilder{
+		Radius:      radius,
+		Clusters:    clusters,
+		MaxLeafSize: maxLeafSize,
+		threadCount: threadCount,
+	}
+}
+
+func (b *PLOCBuilder) Build(p []scene.Primitive, m []scene.Material) *BVH {
+	if len(p) == 0 {
+		return &BVH{primitives: p, materials: m}
+	}
+
+	// Without a radius, clusters outside the exhaustive search would have no neighbour to merge with
+	b.Radius = max(b.Radius, 1)
+	b.threadCount = max(b.threadCount, 1)
+
+	pairs := assignMortonCodes(p, newCurveEncoder(scene.EnclosingCentroids(p), MortonCurve, false), b.threadCount)
+	sortMortonPairs(pairs, BucketSortAlgorithm, b.threadCount)
+
+	clusters := b.initialClusters(pairs, p)
+	for len(clusters) > 1 {
+		clusters = b.merge(clusters)
+	}
+
+	return &BVH{
+		root:       clusters[0],
+		primitives: p,
+		materials:  m,
+	}
+}
+
+// Creates one leaf for each run of equal Morton codes, containing at most MaxLeafSize primitives
+func (b *PLOCBuilder) initialClusters(pairs []mortonPair, prims []scene.Primitive) []*node {
+	clusters := make([]*node, 0, len(pairs))
+	start := 0
+	for i := 1; i <= len(pairs); i++ {
+		if i < len(pairs) && pairs[i].mortonCode == pairs[start].mortonCode && i-start < b.MaxLeafSize {
+			continue
+		}
+
+		pIds := make([]primitiveId, i-start)
+		for j := range pIds {
+			pIds[j] = pairs[start+j].pId
+		}
+		leaf := newLeaf(pIds)
+		leaf.aabb = enclosingSlice(pIds, prims)
+		clusters = append(clusters, leaf)
+		start = i
+	}
+	return clusters
+}
+
+// Runs one iteration of PLOC: finds the nearest neighbour of every cluster and merges mutual nearest neighbours
+func (b *PLOCBuilder) merge(clusters []*node) []*node {
+	n := len(clusters)
+	neighbours := make([]int, n)
+	parallelBatches(n, b.threadCount, func(start, end int) {
+		for i := start; i < end; i++ {
+			neighbours[i] = b.nearestNeighbour(clusters, i)
+		}
+	})
+
+	merged := make([]*node, n)
+	parallelBatches(n, b.threadCount, func(start, end int) {
+		for i := start; i < end; i++ {
+			j := neighbours[i]
+			if neighbours[j] != i {
+				merged[i] = clusters[i]
+			} else if i < j {
+				branch := newBranch(2)
+				branch.addChild(clusters[i], 0)
+				branch.addChild(clusters[j], 1)
+				branch.aabb = clusters[i].aabb.Add(clusters[j].aabb)
+				merged[i] = branch
+			}
+		}
+	})
+
+	// Compact the merged clusters while keeping their order along the curve
+	next := merged[:0]
+	for _, cluster := range merged {
+		if cluster != nil {
+			next = append(next, cluster)
+		}
+	}
+	return next
+}
+
+// Returns the index of the cluster within the search radius whose union with cluster i has the smallest surface.
+// Ties are broken by index, so that the globally best pair is always mutual and every iteration makes progress
+func (b *PLOCBuilder) nearestNeighbour(clusters []*node, i int) int {
+	radius := b.Radius
+	if len(clusters) <= b.Clusters {
+		radius = len(clusters)
+	}
+
+	lo := i - radius
+	if lo < 0 {
+		lo = 0
+	}
+	hi := i + radius
+	if hi > len(clusters)-1 {
+		hi = len(clusters) - 1
+	}
+
+	best := -1
+	bestSurface := math.Inf(1)
+	for j := lo; j <= hi; j++ {
+		if j == i {
+			continue
+		}
+		union := clusters[i].aabb.Add(clusters[j].aabb)
+		if surface := union.Surface(); surface < bestSurface {
+			best = j
+			bestSurface = surface
+		}
+	}
+	return best
+}
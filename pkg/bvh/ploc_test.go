@@ -0,0 +1,56 @@
+package bvh_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPLOC(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	p, mat := s.CollectPrimitives()
+
+	// Clustering finds better trees than splitting along the Morton curve, a larger search radius finds better pairs
+	lbvh := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	narrow := bvh.NewPLOCBuilder(1, bvh.DEFAULT_PLOC_CLUSTERS, bvh.DEFAULT_MAX_LEAF_SIZE, runtime.NumCPU())
+	ploc := bvh.NewDefaultPLOCBuilder()
+	narrowTree := narrow.Build(p, mat)
+	plocTree := ploc.Build(p, mat)
+	require.Less(t, plocTree.Cost(1, 1), narrowTree.Cost(1, 1))
+	require.Less(t, plocTree.Cost(1, 1), lbvh.Cost(1, 1))
+	requireBruteForceHits(t, narrowTree, p)
+	requireBruteForceHits(t, plocTree, p)
+
+	// A large wall lies between two small triangles along the Morton curve. With a radius of 1, the small triangles
+	// are never compared to each other, so one of them has to be merged with the wall first
+	tiny := func(x float64) scene.Primitive {
+		return scene.NewTriangleWithoutNormals(m.NewVector3(x, -0.1, -0.1), m.NewVector3(x, 0.1, -0.1), m.NewVector3(x, 0, 0.1))
+	}
+	wall := scene.NewTriangleWithoutNormals(m.NewVector3(1, -5, -5), m.NewVector3(1, 5, -5), m.NewVector3(1, 0, 5))
+	walled := []scene.Primitive{tiny(0), wall, tiny(2)}
+	costs := map[int]float64{}
+	for _, radius := range []int{1, 2, 100} {
+		builder := bvh.NewPLOCBuilder(radius, bvh.DEFAULT_PLOC_CLUSTERS, 1, runtime.NumCPU())
+		costs[radius] = builder.Build(walled, make([]scene.Material, len(walled))).Cost(1, 1)
+	}
+	require.Less(t, costs[2], costs[1])
+
+	// Once the radius covers all clusters, the search is exhaustive and larger radii have no effect
+	require.Equal(t, costs[2], costs[100])
+
+	// The search is also exhaustive once few enough clusters remain, regardless of the radius
+	exhaustive := bvh.NewPLOCBuilder(1, len(walled), 1, runtime.NumCPU())
+	require.Equal(t, costs[100], exhaustive.Build(walled, make([]scene.Material, len(walled))).Cost(1, 1))
+
+	// Radii below 1 are clamped, so every cluster still has a neighbour
+	for _, radius := range []int{0, -1} {
+		builder := bvh.NewPLOCBuilder(radius, bvh.DEFAULT_PLOC_CLUSTERS, 1, 0)
+		require.Equal(t, costs[1], builder.Build(walled, make([]scene.Material, len(walled))).Cost(1, 1))
+	}
+}
@@ -0,0 +1,177 @@
+package bvh
+
+import (
+	"math"
+	"sort"
+
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Implemented by primitives that can compute the exact closest point on their surface.
+// For other primitives the closest point on their bounding box is used
+type closestPointer interface {
+	ClosestPoint(p m.Vector3) m.Vector3
+}
+
+// Appends the ids of all primitives overlapping the box to out.
+// Primitives that can be clipped are tested exactly, all others by their bounding box.
+func (bvh *BVH) Overlapping(box scene.AABB, out []int) []int {
+	if bvh.root == nil {
+		return out
+	}
+
+	start := len(out)
+	out = bvh.root.overlapping(box, bvh.primitives, out)
+	return bvh.unique(out, start)
+}
+
+func (n *node) overlapping(box scene.AABB, primitives []scene.Primitive, out []int) []int {
+	if !n.aabb.Overlaps(box) {
+		return out
+	}
+
+	if !n.isLeaf {
+		for _, child := range n.children {
+			out = child.overlapping(box, primitives, out)
+		}
+		return out
+	}
+
+	for _, pId := range n.pIds {
+		p := primitives[pId]
+		if !p.Bounding().Overlaps(box) {
+			continue
+		}
+		if c, ok := p.(clippable); ok {
+			if _, ok := c.ClippedBounding(box); !ok {
+				continue
+			}
+		}
+		out = append(out, pId)
+	}
+	return out
+}
+
+// Appends the ids of all primitives with a distance of at most radius to the center to out
+func (bvh *BVH) WithinSphere(center m.Vector3, radius float64, out []int) []int {
+	if bvh.root == nil {
+		return out
+	}
+
+	start := len(out)
+	out = bvh.root.withinSphere(center, radius*radius, bvh.primitives, out)
+	return bvh.unique(out, start)
+}
+
+func (n *node) withinSphere(center m.Vector3, radiusSquared float64, primitives []scene.Primitive, out []int) []int {
+	if distanceSquared(n.aabb.ClosestPoint(center), center) > radiusSquared {
+		return out
+	}
+
+	if !n.isLeaf {
+		for _, child := range n.children {
+			out = child.withinSphere(center, radiusSquared, primitives, out)
+		}
+		return out
+	}
+
+	for _, pId := range n.pIds {
+		if distanceSquared(closestPoint(primitives[pId], center), center) <= radiusSquared {
+			out = append(out, pId)
+		}
+	}
+	return out
+}
+
+// Primitives referenced by multiple leaves are only reported once
+func (bvh *BVH) unique(out []int, start int) []int {
+	if !bvh.splitReferences {
+		return out
+	}
+
+	found := out[start:]
+	sort.Ints(found)
+	n := 0
+	for i, id := range found {
+		if i == 0 || id != found[n-1] {
+			found[n] = id
+			n++
+		}
+	}
+	return out[:start+n]
+}
+
+// Result of a nearest primitive query
+type Nearest struct {
+	PrimitiveId int
+	Point       m.Vector3 // Closest point on the primitive
+	Distance    float64
+}
+
+// Finds the primitive closest to the given point within maxDistance.
+// Children are visited in order of their distance to the point, subtrees farther away than the best primitive are skipped.
+// Returns false if no primitive is within maxDistance.
+func (bvh *BVH) NearestPrimitive(point m.Vector3, maxDistance float64) (Nearest, bool) {
+	if bvh.root == nil {
+		return Nearest{}, false
+	}
+
+	q := nearestQuery{point: point, best: maxDistance * maxDistance, primitives: bvh.primitives}
+	q.nearest.PrimitiveId = -1
+	q.traverse(bvh.root, distanceSquared(bvh.root.aabb.ClosestPoint(point), point))
+	if q.nearest.PrimitiveId < 0 {
+		return Nearest{}, false
+	}
+
+	q.nearest.Distance = math.Sqrt(q.best)
+	return q.nearest, true
+}
+
+type nearestQuery struct {
+	point      m.Vector3
+	best       float64 // Squared distance of the closest primitive found so far
+	nearest    Nearest
+	primitives []scene.Primitive
+}
+
+func (q *nearestQuery) traverse(n *node, dist float64) {
+	if dist > q.best {
+		return
+	}
+
+	if n.isLeaf {
+		for _, pId := range n.pIds {
+			closest := closestPoint(q.primitives[pId], q.point)
+			if d := distanceSquared(closest, q.point); d <= q.best {
+				q.best = d
+				q.nearest.PrimitiveId = pId
+				q.nearest.Point = closest
+			}
+		}
+		return
+	}
+
+	var buf [8]childDistance[*node]
+	sorted := buf[:0]
+	for _, child := range n.children {
+		d := distanceSquared(child.aabb.ClosestPoint(q.point), q.point)
+		sorted = append(sorted, childDistance[*node]{child: child, dist: d})
+	}
+	sortChildren(sorted)
+
+	for _, c := range sorted {
+		q.traverse(c.child, c.dist)
+	}
+}
+
+func closestPoint(p scene.Primitive, point m.Vector3) m.Vector3 {
+	if c, ok := p.(closestPointer); ok {
+		return c.ClosestPoint(point)
+	}
+	return p.Bounding().ClosestPoint(point)
+}
+
+func distanceSquared(a, b m.Vector3) float64 {
+	return a.Sub(b).LengthSquared()
+}
@@ -0,0 +1,89 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpatialQueries(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	p, mat := s.CollectPrimitives()
+
+	sbvh := bvh.NewDefaultSBVHBuilder()
+	trees := map[string]*bvh.BVH{
+		"lbvh": bvh.DefaultLBVH(p, mat, runtime.NumCPU()),
+		"sbvh": sbvh.Build(p, mat),
+	}
+
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(0))
+			for i := 0; i < 100; i++ {
+				center := m.NewRandomVector(-2, 2, r)
+				radius := r.Float64() * 0.5
+				extent := m.NewVector3(radius, radius, radius)
+				box := scene.NewAABB(center.Sub(extent), center.Add(extent))
+
+				var overlapping, within []int
+				nearest := math.Inf(1)
+				for id, prim := range p {
+					tri := prim.(*scene.Triangle)
+					if _, ok := tri.ClippedBounding(box); ok {
+						overlapping = append(overlapping, id)
+					}
+					dist := tri.ClosestPoint(center).Distance(center)
+					if dist <= radius {
+						within = append(within, id)
+					}
+					nearest = math.Min(nearest, dist)
+				}
+
+				actual := tree.Overlapping(box, nil)
+				sort.Ints(actual)
+				require.Equal(t, overlapping, actual)
+
+				actual = tree.WithinSphere(center, radius, nil)
+				sort.Ints(actual)
+				require.Equal(t, within, actual)
+
+				n, ok := tree.NearestPrimitive(center, math.Inf(1))
+				require.True(t, ok)
+				require.Equal(t, nearest, n.Distance)
+				require.InDelta(t, n.Distance, n.Point.Distance(center), 1e-9)
+
+				_, ok = tree.NearestPrimitive(center, nearest*0.99)
+				require.False(t, ok)
+			}
+		})
+	}
+}
+
+func TestTriangleClosestPoint(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 100; i++ {
+		a := m.NewRandomVector(-1, 1, r)
+		b := m.NewRandomVector(-1, 1, r)
+		c := m.NewRandomVector(-1, 1, r)
+		tri := scene.NewTriangleWithoutNormals(a, b, c)
+		point := m.NewRandomVector(-2, 2, r)
+		dist := tri.ClosestPoint(point).Distance(point)
+
+		// No sampled point of the triangle may be closer
+		for u := 0.0; u <= 1; u += 0.05 {
+			for v := 0.0; u+v <= 1; v += 0.05 {
+				sample := a.Mul(1 - u - v).Add(b.Mul(u)).Add(c.Mul(v))
+				require.LessOrEqual(t, dist, sample.Distance(point)+1e-9)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package bvh
+
+import "math/bits"
+
+// Builds the same binary radix tree as constructLBVH, but determines every branch independently from the sorted pairs
+// (Karras 2012), so all levels are built in parallel. Equal codes are ordered by their index, which splits runs of equal
+// codes at different positions than constructLBVH does; the leaf size limits are the same.
+func constructRadixTree(pairs []mortonPair, minLeafSize, maxLeafSize int, threads int) *node {
+	n := len(pairs)
+	isLeafRange := func(first, last int) bool {
+		count := last - first + 1
+		return count <= minLeafSize || pairs[first].mortonCode == pairs[last].mortonCode && count <= maxLeafSize
+	}
+	newLeafRange := func(first, last int) *node {
+		pIds := make([]primitiveId, last-first+1)
+		for i := range pIds {
+			pIds[i] = pairs[first+i].pId
+		}
+		return newLeaf(pIds)
+	}
+
+	if isLeafRange(0, n-1) {
+		return newLeafRange(0, n-1)
+	}
+
+	// Branch i covers the range [first[i], last[i]] of pairs and is split after split[i].
+	// Branches inside a leaf range are not created
+	first := make([]int, n-1)
+	last := make([]int, n-1)
+	split := make([]int, n-1)
+	branches := make([]*node, n-1)
+	parallelBatches(n-1, threads, func(start, end int) {
+		for i := start; i < end; i++ {
+			first[i], last[i], split[i] = findRadixRange(pairs, i)
+			if i == 0 || !isLeafRange(first[i], last[i]) {
+				branches[i] = newBranch(2)
+			}
+		}
+	})
+
+	// The left child of branch i is branch split[i] and the right child branch split[i] + 1, unless they are leaves
+	parallelBatches(n-1, threads, func(start, end int) {
+		for i := start; i < end; i++ {
+			if branches[i] == nil {
+				continue
+			}
+
+			if isLeafRange(first[i], split[i]) {
+				branches[i].addChild(newLeafRange(first[i], split[i]), 0)
+			} else {
+				branches[i].addChild(branches[split[i]], 0)
+			}
+			if isLeafRange(split[i]+1, last[i]) {
+				branches[i].addChild(newLeafRange(split[i]+1, last[i]), 1)
+			} else {
+				branches[i].addChild(branches[split[i]+1], 1)
+			}
+		}
+	})
+	return branches[0]
+}
+
+// Returns the range covered by branch i and the index after which it is split
+func findRadixRange(pairs []mortonPair, i int) (first, last, split int) {
+	// The range extends in the direction of the neighbour with the longer common prefix
+	d := 1
+	if commonPrefix(pairs, i, i+1) < commonPrefix(pairs, i, i-1) {
+		d = -1
+	}
+
+	// Find the other end of the range, whose pairs share a longer prefix with i than the neighbour in the other direction
+	minPrefix := commonPrefix(pairs, i, i-d)
+	maxLength := 2
+	for commonPrefix(pairs, i, i+maxLength*d) > minPrefix {
+		maxLength *= 2
+	}
+	length := 0
+	for step := maxLength / 2; step >= 1; step /= 2 {
+		if commonPrefix(pairs, i, i+(length+step)*d) > minPrefix {
+			length += step
+		}
+	}
+	j := i + length*d
+
+	// Find the last pair that shares a longer prefix with i than the whole range
+	nodePrefix := commonPrefix(pairs, i, j)
+	offset := 0
+	for step := length; step > 1; {
+		step = (step + 1) / 2
+		if commonPrefix(pairs, i, i+(offset+step)*d) > nodePrefix {
+			offset += step
+		}
+	}
+
+	return min(i, j), max(i, j), i + offset*d + min(d, 0)
+}
+
+// Returns the number of leading bits shared by the codes of i and j, or -1 if j is out of range.
+// Equal codes continue with the bits of their indices
+func commonPrefix(pairs []mortonPair, i, j int) int {
+	if j < 0 || j >= len(pairs) {
+		return -1
+	}
+	if pairs[i].mortonCode == pairs[j].mortonCode {
+		return 64 + bits.LeadingZeros64(uint64(i^j))
+	}
+	return bits.LeadingZeros64(pairs[i].mortonCode ^ pairs[j].mortonCode)
+}
@@ -0,0 +1,41 @@
+package bvh
+
+import (
+	"fmt"
+
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Replaces the primitives of the tree with moved or deformed versions and recomputes all bounding boxes
+// bottom-up in parallel. The topology is kept, so prims must correspond to the primitives the tree was built
+// from, in the same order. Leaves of trees with split references are refitted to the full primitive bounds.
+func (bvh *BVH) Refit(prims []scene.Primitive, threads int) error {
+	if len(prims) != len(bvh.primitives) {
+		return fmt.Errorf("refit requires %d primitives, got %d", len(bvh.primitives), len(prims))
+	}
+
+	// The tree uses the new slice from now on, so it has to be copied again before it is modified
+	bvh.ownsPrimitives = false
+	if bvh.root == nil {
+		bvh.primitives = prims
+		return nil
+	}
+
+	if bvh.refitBaseline == 0 {
+		bvh.refitBaseline = bvh.Cost(sahTraversalCost, sahIntersectionCost)
+	}
+
+	bvh.primitives = prims
+	bvh.updateBounding(threads)
+	return nil
+}
+
+// Returns the ratio between the current SAH cost and the SAH cost before the tree was first refitted.
+// The ratio grows as the primitives move away from the configuration the topology was built for,
+// callers typically rebuild the tree once it exceeds a threshold like 1.5.
+func (bvh *BVH) Degradation() float64 {
+	if bvh.refitBaseline == 0 {
+		return 1
+	}
+	return bvh.Cost(sahTraversalCost, sahIntersectionCost) / bvh.refitBaseline
+}
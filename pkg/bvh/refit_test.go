@@ -0,0 +1,47 @@
+package bvh_test
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefit(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{Albedo: scene.NewColor(1, 0, 0)})
+	p, mat := s.CollectPrimitives()
+	tree := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	ray := m.NewRay(m.NewVector3(0, 0, 5), m.NewVector3(0, 0, -1))
+
+	hit := scene.Hit{}
+	require.True(t, tree.ClosestHit(ray, 0.001, math.Inf(1), &hit))
+	require.Equal(t, 1.0, tree.Degradation())
+
+	// Moving all primitives keeps the relative layout, so the quality of the tree does not change
+	moved := make([]scene.Primitive, len(p))
+	for i, prim := range p {
+		moved[i] = prim.Transformed(m.Translate(10, 0, 0))
+	}
+	require.NoError(t, tree.Refit(moved, runtime.NumCPU()))
+	require.False(t, tree.ClosestHit(ray, 0.001, math.Inf(1), &hit))
+	require.InDelta(t, 1.0, tree.Degradation(), 1e-6)
+
+	ray = m.NewRay(m.NewVector3(10, 0, 5), m.NewVector3(0, 0, -1))
+	require.True(t, tree.ClosestHit(ray, 0.001, math.Inf(1), &hit))
+
+	// Scaling along a single axis deforms the mesh and degrades the tree
+	deformed := make([]scene.Primitive, len(p))
+	for i, prim := range p {
+		deformed[i] = prim.Transformed(m.Scale(1, 10, 1))
+	}
+	require.NoError(t, tree.Refit(deformed, runtime.NumCPU()))
+	require.Greater(t, tree.Degradation(), 1.0)
+
+	require.Error(t, tree.Refit(p[1:], runtime.NumCPU()))
+}
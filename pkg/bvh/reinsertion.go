@@ -0,0 +1,238 @@
+package bvh
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Iteratively optimizes a tree by removing the nodes with the highest SAH inefficiency and reinserting
+// their children at the positions that increase the SAH cost the least (Bittner et al. 2013).
+type ReinsertionOptimizer struct {
+	Iterations int           // Maximum number of iterations
+	Budget     time.Duration // No further iterations are started after this time, 0 disables the limit
+	Fraction   float64       // Fraction of internal nodes that are reinserted in each iteration
+}
+
+func NewDefaultReinsertionOptimizer() ReinsertionOptimizer {
+	return ReinsertionOptimizer{
+		Iterations: 50,
+		Fraction:   0.01,
+	}
+}
+
+// Optimizes the tree in place. Stops early if an iteration did not decrease the SAH cost, that iteration is undone.
+// Returns the SAH cost of the tree before and after the optimization.
+func (o *ReinsertionOptimizer) Optimize(tree *BVH) (before, after float64) {
+	before = tree.Cost(sahTraversalCost, sahIntersectionCost)
+	after = before
+	if tree.root == nil || tree.root.isLeaf {
+		return before, after
+	}
+	start := time.Now()
+
+	for i := 0; i < o.Iterations; i++ {
+		if o.Budget > 0 && time.Since(start) > o.Budget {
+			break
+		}
+
+		candidates := o.candidates(tree)
+		if len(candidates) == 0 {
+			break
+		}
+
+		snapshot := tree.root.clone()
+		for _, n := range candidates {
+			tree.reinsertChildren(n)
+		}
+
+		cost := tree.Cost(sahTraversalCost, sahIntersectionCost)
+		if cost >= after {
+			tree.root = snapshot
+			break
+		}
+		after = cost
+	}
+
+	return before, after
+}
+
+// Copies the subtree, primitive ids of leaves are shared
+func (n *node) clone() *node {
+	c := &node{
+		aabb:   n.aabb,
+		isLeaf: n.isLeaf,
+		pIds:   n.pIds,
+		size:   n.size,
+	}
+	if !n.isLeaf {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			c.addChild(child.clone(), i)
+		}
+	}
+	return c
+}
+
+// Returns the removable nodes with the highest inefficiency, i.e. nodes which have a large surface
+// compared to the surface of their children
+func (o *ReinsertionOptimizer) candidates(tree *BVH) []*node {
+	type candidate struct {
+		node        *node
+		inefficency float64
+	}
+
+	var candidates []candidate
+	var collect func(n *node)
+	collect = func(n *node) {
+		if n.isLeaf {
+			return
+		}
+		if n.removable() {
+			surface := n.aabb.Surface()
+			left := n.children[0].aabb.Surface()
+			right := n.children[1].aabb.Surface()
+			mSum := surface / (0.5 * (left + right))
+			mMin := surface / math.Min(left, right)
+			candidates = append(candidates, candidate{node: n, inefficency: mSum * mMin * surface})
+		}
+		for _, child := range n.children {
+			collect(child)
+		}
+	}
+	collect(tree.root)
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].inefficency > candidates[j].inefficency
+	})
+
+	count := int(math.Ceil(o.Fraction * float64(len(candidates))))
+	nodes := make([]*node, count)
+	for i := range nodes {
+		nodes[i] = candidates[i].node
+	}
+	return nodes
+}
+
+// Nodes can be removed if they are binary and have a binary parent that is not the root
+func (n *node) removable() bool {
+	return !n.isLeaf && len(n.children) == 2 &&
+		n.parent != nil && len(n.parent.children) == 2 && n.parent.parent != nil
+}
+
+// Removes the node and its parent from the tree and reinserts the children of the node.
+// The removed node and its parent are reused as branches at the new insertion points
+func (tree *BVH) reinsertChildren(n *node) {
+	if !n.removable() {
+		return
+	}
+
+	parent := n.parent
+	sibling := parent.children[0]
+	if sibling == n {
+		sibling = parent.children[1]
+	}
+	parent.parent.replaceChild(parent, sibling)
+	refitAncestors(sibling.parent)
+
+	left := n.children[0]
+	right := n.children[1]
+	if left.aabb.Surface() < right.aabb.Surface() {
+		left, right = right, left
+	}
+	tree.insertSubtree(left, n)
+	tree.insertSubtree(right, parent)
+}
+
+// Inserts the subtree next to the node where it causes the smallest increase of the SAH cost.
+// The given branch is used to connect the subtree with its new sibling
+func (tree *BVH) insertSubtree(subtree *node, branch *node) {
+	sibling := tree.bestSibling(subtree.aabb)
+	parent := sibling.parent
+	if parent == nil {
+		tree.root = branch
+		branch.parent = nil
+	} else {
+		parent.replaceChild(sibling, branch)
+	}
+
+	branch.isLeaf = false
+	branch.pIds = nil
+	branch.children = []*node{nil, nil}
+	branch.addChild(sibling, 0)
+	branch.addChild(subtree, 1)
+	branch.aabb = sibling.aabb.Add(subtree.aabb)
+	branch.size = 0
+	refitAncestors(parent)
+}
+
+// Branch and bound search for the node that, if it became the sibling of a node with the given bounding box,
+// would increase the SAH cost the least. Nodes are processed in order of the cost induced on their ancestors.
+func (tree *BVH) bestSibling(box scene.AABB) *node {
+	best := tree.root
+	union := best.aabb.Add(box)
+	bestCost := union.Surface()
+	boxSurface := box.Surface()
+
+	queue := &insertionQueue{{node: tree.root, induced: 0}}
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(insertionCandidate)
+		if c.induced+boxSurface >= bestCost {
+			break
+		}
+
+		union := c.node.aabb.Add(box)
+		direct := union.Surface()
+		if cost := c.induced + direct; cost < bestCost {
+			best = c.node
+			bestCost = cost
+		}
+
+		if c.node.isLeaf {
+			continue
+		}
+
+		// Descending increases the surface of this node, which is a lower bound for the cost of all children
+		induced := c.induced + direct - c.node.aabb.Surface()
+		if induced+boxSurface < bestCost {
+			for _, child := range c.node.children {
+				heap.Push(queue, insertionCandidate{node: child, induced: induced})
+			}
+		}
+	}
+
+	return best
+}
+
+type insertionCandidate struct {
+	node    *node
+	induced float64 // Increase of the surfaces of all ancestors if inserted below this node
+}
+
+// Min-heap of insertion candidates ordered by induced cost
+type insertionQueue []insertionCandidate
+
+func (q insertionQueue) Len() int           { return len(q) }
+func (q insertionQueue) Less(i, j int) bool { return q[i].induced < q[j].induced }
+func (q insertionQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *insertionQueue) Push(x any)        { *q = append(*q, x.(insertionCandidate)) }
+func (q *insertionQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Recomputes the bounding boxes and invalidates the cached subtree sizes from the given node up to the root
+func refitAncestors(n *node) {
+	for ; n != nil; n = n.parent {
+		n.size = 0
+		n.aabb = n.children[0].aabb
+		for _, child := range n.children[1:] {
+			n.aabb = n.aabb.Add(child.aabb)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package bvh_test
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReinsertionOptimizer(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	p, mat := s.CollectPrimitives()
+
+	tree := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	cost := tree.Cost(1, 1)
+	optimizer := bvh.NewDefaultReinsertionOptimizer()
+	before, after := optimizer.Optimize(tree)
+	require.Equal(t, cost, before)
+	require.Less(t, after, before)
+	require.InDelta(t, tree.Cost(1, 1), after, 1e-9)
+	requireBruteForceHits(t, tree, p)
+
+	// Without iterations, the tree is left unchanged
+	tree = bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	optimizer.Iterations = 0
+	before, after = optimizer.Optimize(tree)
+	require.Equal(t, before, after)
+	require.Equal(t, before, tree.Cost(1, 1))
+
+	// Iterations that make the tree more expensive are undone, even for trees that are already good
+	random := randomTriangles(2000, rand.New(rand.NewSource(0)))
+	sah := bvh.NewDefaultSAHBuilder()
+	ploc := bvh.NewDefaultPLOCBuilder()
+	for _, p := range [][]scene.Primitive{p, random} {
+		mat := make([]scene.Material, len(p))
+		for _, tree := range []*bvh.BVH{bvh.DefaultLBVH(p, mat, runtime.NumCPU()), sah.Build(p, mat), ploc.Build(p, mat)} {
+			for _, fraction := range []float64{0.01, 0.1, 0.5} {
+				optimizer := bvh.NewDefaultReinsertionOptimizer()
+				optimizer.Fraction = fraction
+				before, after := optimizer.Optimize(tree)
+				require.LessOrEqual(t, after, before)
+				require.InDelta(t, tree.Cost(1, 1), after, 1e-9)
+				requireBruteForceHits(t, tree, p)
+			}
+		}
+	}
+
+	// Trees without branches are left unchanged
+	optimizer = bvh.NewDefaultReinsertionOptimizer()
+	empty := bvh.DefaultLBVH([]scene.Primitive{}, []scene.Material{}, runtime.NumCPU())
+	before, after = optimizer.Optimize(empty)
+	require.Zero(t, before)
+	require.Zero(t, after)
+
+	single := bvh.DefaultLBVH(p[:1], mat[:1], runtime.NumCPU())
+	before, after = optimizer.Optimize(single)
+	require.Equal(t, before, after)
+	requireBruteForceHits(t, single, p[:1])
+}
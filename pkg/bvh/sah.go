@@ -0,0 +1,297 @@
+package bvh
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+const (
+	DEFAULT_SAH_BINS      = 16
+	DEFAULT_MAX_LEAF_SIZE = 4
+
+	// Costs used to weigh traversal steps against primitive intersections
+	sahTraversalCost    = 1.0
+	sahIntersectionCost = 1.0
+)
+
+// Top-down builder that splits nodes according to the SAH evaluated on a fixed number of centroid bins.
+// Used as a high quality reference for the LBVH and PHR builders.
+type SAHBuilder struct {
+	Bins        int       // Number of bins evaluated along each axis
+	MaxLeafSize int       // Nodes with more primitives are always split
+	Cost        CostModel // Used to compare splits and leaves
+
+	jobs        chan sahJob
+	threadCount int
+	boxes       []scene.AABB
+}
+
+func NewDefaultSAHBuilder() SAHBuilder {
+	return NewSAHBuilder(DEFAULT_SAH_BINS, DEFAULT_MAX_LEAF_SIZE, runtime.GOMAXPROCS(0))
+}
+
+func NewSAHBuilder(bins int, maxLeafSize int, threadCount int) SAHBuilder {
+	return SAHBuilder{
+		Bins:        bins,
+		MaxLeafSize: maxLeafSize,
+		Cost:        DefaultCostModel(),
+		threadCount: threadCount,
+	}
+}
+
+func (b *SAHBuilder) Build(p []scene.Primitive, m []scene.Material) *BVH {
+	if len(p) == 0 {
+		return &BVH{primitives: p, materials: m}
+	}
+
+	// At least two bins are needed to evaluate a split and at least one thread to process the jobs
+	b.Bins = max(b.Bins, 2)
+	b.threadCount = max(b.threadCount, 1)
+
+	b.boxes = primitiveBounds(p, b.threadCount)
+	ids := make([]primitiveId, len(p))
+	for i := range ids {
+		ids[i] = i
+	}
+
+	wg := sync.WaitGroup{}
+	b.jobs = make(chan sahJob, b.threadCount)
+	for i := 0; i < b.threadCount; i++ {
+		go func() {
+			for job := range b.jobs {
+				b.buildSubTree(job, &wg)
+			}
+		}()
+	}
+
+	// Temporary branch as a starting point, will be discared afterwards
+	temp := newBranch(1)
+	wg.Add(1)
+	b.jobs <- sahJob{
+		pIds:       ids,
+		parent:     temp,
+		childIndex: 0,
+	}
+
+	wg.Wait()
+	close(b.jobs)
+
+	root := temp.children[0]
+	root.parent = nil
+	return &BVH{
+		root:       root,
+		primitives: p,
+		materials:  m,
+	}
+}
+
+type sahJob struct {
+	pIds       []primitiveId
+	parent     *node
+	childIndex int
+}
+
+func (b *SAHBuilder) buildSubTree(job sahJob, wg *sync.WaitGroup) {
+	bounding, centroids := b.enclosing(job.pIds)
+
+	split := 0
+	if len(job.pIds) > 1 {
+		split = b.partition(job.pIds, bounding, centroids)
+	}
+
+	if split == 0 {
+		leaf := newLeaf(job.pIds)
+		leaf.aabb = bounding
+		job.parent.addChild(leaf, job.childIndex)
+		wg.Done()
+		return
+	}
+
+	branch := newBranch(2)
+	branch.aabb = bounding
+	job.parent.addChild(branch, job.childIndex)
+
+	wg.Add(1)
+	b.queue(sahJob{pIds: job.pIds[:split], parent: branch, childIndex: 0}, wg)
+	b.queue(sahJob{pIds: job.pIds[split:], parent: branch, childIndex: 1}, wg)
+}
+
+// If channel is full, directly process job
+func (b *SAHBuilder) queue(job sahJob, wg *sync.WaitGroup) {
+	select {
+	case b.jobs <- job:
+	default:
+		b.buildSubTree(job, wg)
+	}
+}
+
+// Computes the bounding box of the given primitives and the bounding box of their centroids
+func (b *SAHBuilder) enclosing(pIds []primitiveId) (bounding scene.AABB, centroids scene.AABB) {
+	bounding = b.boxes[pIds[0]]
+	min := bounding.Barycenter
+	max := bounding.Barycenter
+	for _, id := range pIds[1:] {
+		box := b.boxes[id]
+		bounding = bounding.Add(box)
+		min = m.MinVec(min, box.Barycenter)
+		max = m.MaxVec(max, box.Barycenter)
+	}
+	return bounding, scene.NewAABB(min, max)
+}
+
+type sahBin struct {
+	bounding scene.AABB
+	count    int
+}
+
+func (bin *sahBin) add(box scene.AABB) {
+	bin.addWeighted(box, 1)
+}
+
+func (bin *sahBin) addWeighted(box scene.AABB, weight int) {
+	if bin.count == 0 {
+		bin.bounding = box
+	} else {
+		bin.bounding = bin.bounding.Add(box)
+	}
+	bin.count += weight
+}
+
+func (bin *sahBin) merge(other sahBin) {
+	if other.count == 0 {
+		return
+	}
+	if bin.count == 0 {
+		bin.bounding = other.bounding
+	} else {
+		bin.bounding = bin.bounding.Add(other.bounding)
+	}
+	bin.count += other.count
+}
+
+// Finds the cheapest binned SAH split and partitions pIds in place accordingly.
+// Returns the index of the first primitive of the right child or 0 if the primitives should form a leaf
+func (b *SAHBuilder) partition(pIds []primitiveId, bounding scene.AABB, centroids scene.AABB) int {
+	n := len(pIds)
+	box := func(i int) scene.AABB { return b.boxes[pIds[i]] }
+	split := findObjectSplit(n, box, unitWeight, bounding, centroids, b.Bins, b.Cost)
+
+	// All centroids are identical, so the only option is to split by count
+	if split.axis < 0 {
+		if n > b.MaxLeafSize {
+			return n / 2
+		}
+		return 0
+	}
+
+	if split.cost >= b.Cost.Leaf(bounding.Surface(), n) && n <= b.MaxLeafSize {
+		return 0
+	}
+
+	lo := centroids.Bounds[0].Component(split.axis)
+	extent := centroids.Bounds[1].Component(split.axis) - lo
+	i := 0
+	j := n - 1
+	for i <= j {
+		if binIndex(b.boxes[pIds[i]].Barycenter, split.axis, lo, extent, b.Bins) < split.bin {
+			i++
+		} else {
+			pIds[i], pIds[j] = pIds[j], pIds[i]
+			j--
+		}
+	}
+	return i
+}
+
+type objectSplit struct {
+	cost  float64
+	axis  int // -1 if no valid split was found
+	bin   int // Index of the first bin belonging to the right side
+	left  scene.AABB
+	right scene.AABB
+}
+
+// Evaluates the SAH of all bin boundaries along all axes and returns the cheapest split.
+// Each item counts as weight(i) primitives. The costs are not normalized by the surface of the parent
+func findObjectSplit(n int, box func(int) scene.AABB, weight func(int) int, bounding scene.AABB, centroids scene.AABB, binCount int, c CostModel) objectSplit {
+	surface := bounding.Surface()
+	best := objectSplit{cost: math.Inf(1), axis: -1}
+
+	bins := make([]sahBin, binCount)
+	rightBins := make([]sahBin, binCount)
+	for axis := 0; axis < 3; axis++ {
+		lo := centroids.Bounds[0].Component(axis)
+		extent := centroids.Bounds[1].Component(axis) - lo
+		if extent <= 0 {
+			continue
+		}
+
+		for i := range bins {
+			bins[i] = sahBin{}
+		}
+		for i := 0; i < n; i++ {
+			b := box(i)
+			bins[binIndex(b.Barycenter, axis, lo, extent, binCount)].addWeighted(b, weight(i))
+		}
+
+		// Sweep from the right to track all right partitions
+		right := sahBin{}
+		for i := binCount - 1; i > 0; i-- {
+			right.merge(bins[i])
+			rightBins[i] = right
+		}
+
+		// Sweep from the left and combine with the tracked right partitions
+		left := sahBin{}
+		for i := 1; i < binCount; i++ {
+			left.merge(bins[i-1])
+			right := rightBins[i]
+			if left.count == 0 || right.count == 0 {
+				continue
+			}
+
+			cost := c.Branch(surface, left.bounding, left.count, right.bounding, right.count)
+			if cost < best.cost {
+				best = objectSplit{
+					cost:  cost,
+					axis:  axis,
+					bin:   i,
+					left:  left.bounding,
+					right: right.bounding,
+				}
+			}
+		}
+	}
+
+	return best
+}
+
+func unitWeight(int) int {
+	return 1
+}
+
+func binIndex(centroid m.Vector3, axis int, lo, extent float64, bins int) int {
+	i := int((centroid.Component(axis) - lo) / extent * float64(bins))
+	if i >= bins {
+		return bins - 1
+	}
+	if i < 0 {
+		return 0
+	}
+	return i
+}
+
+// Collects the bounding boxes of all primitives in parallel
+func primitiveBounds(prims []scene.Primitive, threads int) []scene.AABB {
+	boxes := make([]scene.AABB, len(prims))
+	parallelBatches(len(prims), threads, func(start, end int) {
+		for j := start; j < end; j++ {
+			boxes[j] = prims[j].Bounding()
+		}
+	})
+	return boxes
+}
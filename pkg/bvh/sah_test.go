@@ -0,0 +1,84 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSAH(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	p, mat := s.CollectPrimitives()
+
+	// The SAH builder serves as the quality reference for the LBVH, more bins approximate the SAH more closely
+	lbvh := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	coarse := bvh.NewSAHBuilder(2, bvh.DEFAULT_MAX_LEAF_SIZE, runtime.NumCPU())
+	fine := bvh.NewDefaultSAHBuilder()
+	coarseTree := coarse.Build(p, mat)
+	fineTree := fine.Build(p, mat)
+	require.Less(t, fineTree.Cost(1, 1), coarseTree.Cost(1, 1))
+	require.Less(t, fineTree.Cost(1, 1), lbvh.Cost(1, 1))
+	requireBruteForceHits(t, fineTree, p)
+	requireBruteForceHits(t, coarseTree, p)
+
+	// Identical primitives cannot be separated by the SAH, so they are split by count until leaves are small enough.
+	// All nodes have the same surface, so the cost is the number of branches plus the number of primitives
+	identical := make([]scene.Primitive, 8)
+	for i := range identical {
+		identical[i] = scene.NewTriangleWithoutNormals(m.NewVector3(0, 0, 0), m.NewVector3(1, 0, 0), m.NewVector3(0, 1, 0))
+	}
+	for maxLeafSize, cost := range map[int]float64{1: 15, 2: 11, 8: 8} {
+		builder := bvh.NewSAHBuilder(bvh.DEFAULT_SAH_BINS, maxLeafSize, runtime.NumCPU())
+		require.Equal(t, cost, builder.Build(identical, make([]scene.Material, len(identical))).Cost(1, 1))
+	}
+
+	// Expensive traversals result in fewer, larger leaves
+	builder := bvh.NewDefaultSAHBuilder()
+	builder.Cost = bvh.CostModel{Traversal: 100, Intersection: 1}
+	leaves := builder.Build(p, mat).Stats().Leaves
+	builder.Cost = bvh.CostModel{Traversal: 1, Intersection: 100}
+	require.Less(t, leaves, builder.Build(p, mat).Stats().Leaves)
+
+	// Invalid settings are clamped to the smallest usable number of bins and threads
+	noBins := bvh.NewSAHBuilder(0, bvh.DEFAULT_MAX_LEAF_SIZE, runtime.NumCPU())
+	require.Equal(t, coarseTree.Cost(1, 1), noBins.Build(p, mat).Cost(1, 1))
+	noThreads := bvh.NewSAHBuilder(bvh.DEFAULT_SAH_BINS, bvh.DEFAULT_MAX_LEAF_SIZE, 0)
+	require.Equal(t, fineTree.Cost(1, 1), noThreads.Build(p, mat).Cost(1, 1))
+}
+
+// Compares the closest hits of random rays through the scene with intersecting every primitive
+func requireBruteForceHits(t *testing.T, tree *bvh.BVH, p []scene.Primitive) {
+	r := rand.New(rand.NewSource(0))
+	box := scene.EnclosingAABB(p)
+	size := box.Size()
+	random := func() m.Vector3 {
+		return box.Bounds[0].Add(size.ElemMul(m.NewRandomVector(-0.5, 1.5, r)))
+	}
+
+	for i := 0; i < 1000; i++ {
+		origin := random()
+		ray := m.NewRay(origin, random().Sub(origin))
+
+		expected := scene.Hit{T: math.Inf(1)}
+		found := false
+		for _, prim := range p {
+			if prim.Intersected(ray, 0.001, expected.T, &expected) {
+				found = true
+			}
+		}
+
+		actual := scene.Hit{}
+		require.Equal(t, found, tree.ClosestHit(ray, 0.001, math.Inf(1), &actual))
+		if found {
+			require.InDelta(t, expected.T, actual.T, 1e-9)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package bvh
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+const (
+	DEFAULT_SBVH_ALPHA = 1e-5
+
+	// Spatial splits are no longer considered below this depth, which bounds the number of duplicated references
+	MAX_SBVH_DEPTH = 48
+)
+
+// Top-down builder implementing the spatial split BVH (Stich et al. 2009).
+// Besides binned object splits, nodes may be split by a plane that clips the primitives straddling it,
+// so a primitive can be referenced by multiple leaves. Leaves are bounded by the clipped references.
+type SBVHBuilder struct {
+	Bins        int       // Number of bins evaluated along each axis
+	MaxLeafSize int       // Nodes with more primitives are always split
+	Alpha       float64   // Spatial splits are only tried if the children of the best object split overlap by more than Alpha times the root surface
+	Cost        CostModel // Used to compare splits and leaves
+
+	jobs        chan sbvhJob
+	threadCount int
+	rootSurface float64
+	primitives  []scene.Primitive
+}
+
+// Primitives that support tighter bounds than their bounding box intersected with the clipping box
+type clippable interface {
+	ClippedBounding(box scene.AABB) (scene.AABB, bool)
+}
+
+func NewDefaultSBVHBuilder() SBVHBuilder {
+	return NewSBVHBuilder(DEFAULT_SAH_BINS, DEFAULT_MAX_LEAF_SIZE, DEFAULT_SBVH_ALPHA, runtime.GOMAXPROCS(0))
+}
+
+func NewSBVHBuilder(bins int, maxLeafSize int, alpha float64, threadCount int) SBVHBuilder {
+	return SBVHBuilder{
+		Bins:        bins,
+		MaxLeafSize: maxLeafSize,
+		Alpha:       alpha,
+		Cost:        DefaultCostModel(),
+		threadCount: threadCount,
+	}
+}
+
+func (b *SBVHBuilder) Build(p []scene.Primitive, mat []scene.Material) *BVH {
+	if len(p) == 0 {
+		return &BVH{primitives: p, materials: mat, splitReferences: true}
+	}
+
+	// At least two bins are needed to evaluate a split and at least one thread to process the jobs
+	b.Bins = max(b.Bins, 2)
+	b.threadCount = max(b.threadCount, 1)
+
+	b.primitives = p
+	boxes := primitiveBounds(p, b.threadCount)
+	refs := make([]sbvhRef, len(p))
+	for i, box := range boxes {
+		refs[i] = sbvhRef{pId: i, box: box}
+	}
+	bounding, _ := enclosingRefs(refs)
+	b.rootSurface = bounding.Surface()
+
+	wg := sync.WaitGroup{}
+	b.jobs = make(chan sbvhJob, b.threadCount)
+	for i := 0; i < b.threadCount; i++ {
+		go func() {
+			for job := range b.jobs {
+				b.buildSubTree(job, &wg)
+			}
+		}()
+	}
+
+	// Temporary branch as a starting point, will be discared afterwards
+	temp := newBranch(1)
+	wg.Add(1)
+	b.jobs <- sbvhJob{
+		refs:       refs,
+		parent:     temp,
+		childIndex: 0,
+	}
+
+	wg.Wait()
+	close(b.jobs)
+
+	root := temp.children[0]
+	root.parent = nil
+	return &BVH{
+		root:            root,
+		primitives:      p,
+		materials:       mat,
+		splitReferences: true,
+	}
+}
+
+// A reference to a primitive together with its (possibly clipped) bounding box
+type sbvhRef struct {
+	pId primitiveId
+	box scene.AABB
+}
+
+type sbvhJob struct {
+	refs       []sbvhRef
+	parent     *node
+	childIndex int
+	depth      int
+}
+
+func (b *SBVHBuilder) buildSubTree(job sbvhJob, wg *sync.WaitGroup) {
+	bounding, centroids := enclosingRefs(job.refs)
+	left, right := b.split(job.refs, bounding, centroids, job.depth)
+
+	if left == nil {
+		pIds := make([]primitiveId, len(job.refs))
+		for i, ref := range job.refs {
+			pIds[i] = ref.pId
+		}
+		leaf := newLeaf(pIds)
+		leaf.aabb = bounding
+		job.parent.addChild(leaf, job.childIndex)
+		wg.Done()
+		return
+	}
+
+	branch := newBranch(2)
+	branch.aabb = bounding
+	job.parent.addChild(branch, job.childIndex)
+
+	wg.Add(1)
+	b.queue(sbvhJob{refs: left, parent: branch, childIndex: 0, depth: job.depth + 1}, wg)
+	b.queue(sbvhJob{refs: right, parent: branch, childIndex: 1, depth: job.depth + 1}, wg)
+}
+
+// If channel is full, directly process job
+func (b *SBVHBuilder) queue(job sbvhJob, wg *sync.WaitGroup) {
+	select {
+	case b.jobs <- job:
+	default:
+		b.buildSubTree(job, wg)
+	}
+}
+
+// Chooses the cheapest out of an object split, a spatial split and a leaf.
+// Returns nil slices if the references should form a leaf
+func (b *SBVHBuilder) split(refs []sbvhRef, bounding scene.AABB, centroids scene.AABB, depth int) (left, right []sbvhRef) {
+	n := len(refs)
+	if n == 1 {
+		return nil, nil
+	}
+
+	box := func(i int) scene.AABB { return refs[i].box }
+	object := findObjectSplit(n, box, unitWeight, bounding, centroids, b.Bins, b.Cost)
+
+	// Only try spatial splits if the object split produces children with a large overlap
+	spatial := spatialSplit{cost: math.Inf(1), axis: -1}
+	if depth < MAX_SBVH_DEPTH {
+		overlap := 0.0
+		if overlapBox, ok := object.left.Intersect(object.right); ok && object.axis >= 0 {
+			overlap = overlapBox.Surface()
+		}
+		if object.axis < 0 || overlap/b.rootSurface > b.Alpha {
+			spatial = b.findSpatialSplit(refs, bounding)
+		}
+	}
+
+	// Spatial splits that duplicate every reference into both children only shrink the bounds. If the centroids are
+	// identical, the references could be duplicated until the maximum depth without ever being separated
+	if object.axis < 0 && spatial.leftCount == n && spatial.rightCount == n {
+		spatial.cost = math.Inf(1)
+	}
+
+	leafCost := b.Cost.Leaf(bounding.Surface(), n)
+	if math.Min(object.cost, spatial.cost) >= leafCost && n <= b.MaxLeafSize {
+		return nil, nil
+	}
+
+	if spatial.cost < object.cost {
+		left, right = b.performSpatialSplit(refs, spatial)
+		if len(left) > 0 && len(right) > 0 {
+			return left, right
+		}
+	}
+
+	if object.axis >= 0 {
+		lo := centroids.Bounds[0].Component(object.axis)
+		extent := centroids.Bounds[1].Component(object.axis) - lo
+		i := 0
+		j := n - 1
+		for i <= j {
+			if binIndex(refs[i].box.Barycenter, object.axis, lo, extent, b.Bins) < object.bin {
+				i++
+			} else {
+				refs[i], refs[j] = refs[j], refs[i]
+				j--
+			}
+		}
+		return refs[:i], refs[i:]
+	}
+
+	// All centroids are identical, so the only option is to split by count
+	if n > b.MaxLeafSize {
+		return refs[:n/2], refs[n/2:]
+	}
+	return nil, nil
+}
+
+type spatialSplit struct {
+	cost       float64
+	axis       int // -1 if no valid split was found
+	position   float64
+	left       scene.AABB
+	right      scene.AABB
+	leftCount  int
+	rightCount int
+}
+
+// Bins the node bounds spatially and clips every reference into all bins it overlaps.
+// Evaluates the SAH at every bin boundary along all axes and returns the cheapest split
+func (b *SBVHBuilder) findSpatialSplit(refs []sbvhRef, bounding scene.AABB) spatialSplit {
+	surface := bounding.Surface()
+	best := spatialSplit{cost: math.Inf(1), axis: -1}
+
+	bins := make([]sahBin, b.Bins)
+	rightBins := make([]sahBin, b.Bins)
+	entries := make([]int, b.Bins)
+	exits := make([]int, b.Bins)
+	rightCounts := make([]int, b.Bins)
+	for axis := 0; axis < 3; axis++ {
+		lo := bounding.Bounds[0].Component(axis)
+		width := (bounding.Bounds[1].Component(axis) - lo) / float64(b.Bins)
+		if width <= 0 {
+			continue
+		}
+
+		for i := range bins {
+			bins[i] = sahBin{}
+			entries[i] = 0
+			exits[i] = 0
+		}
+
+		for _, ref := range refs {
+			first := spatialBin(ref.box.Bounds[0].Component(axis), lo, width, b.Bins)
+			last := spatialBin(ref.box.Bounds[1].Component(axis), lo, width, b.Bins)
+			entries[first]++
+			exits[last]++
+			for i := first; i <= last; i++ {
+				if clipped, ok := b.clip(ref, axis, lo+float64(i)*width, lo+float64(i+1)*width); ok {
+					bins[i].add(clipped)
+				}
+			}
+		}
+
+		// Sweep from the right to track all right partitions
+		right := sahBin{}
+		count := 0
+		for i := b.Bins - 1; i > 0; i-- {
+			right.merge(bins[i])
+			count += exits[i]
+			rightBins[i] = right
+			rightCounts[i] = count
+		}
+
+		// Sweep from the left and combine with the tracked right partitions
+		left := sahBin{}
+		count = 0
+		for i := 1; i < b.Bins; i++ {
+			left.merge(bins[i-1])
+			count += entries[i-1]
+			if count == 0 || rightCounts[i] == 0 || left.count == 0 || rightBins[i].count == 0 {
+				continue
+			}
+
+			cost := b.Cost.Branch(surface, left.bounding, count, rightBins[i].bounding, rightCounts[i])
+			if cost < best.cost {
+				best = spatialSplit{
+					cost:       cost,
+					axis:       axis,
+					position:   lo + float64(i)*width,
+					left:       left.bounding,
+					right:      rightBins[i].bounding,
+					leftCount:  count,
+					rightCount: rightCounts[i],
+				}
+			}
+		}
+	}
+
+	return best
+}
+
+// Distributes the references according to the split plane. References straddling the plane are either
+// clipped and duplicated or, if that is cheaper, moved entirely to one side (reference unsplitting)
+func (b *SBVHBuilder) performSpatialSplit(refs []sbvhRef, split spatialSplit) (left, right []sbvhRef) {
+	left = make([]sbvhRef, 0, split.leftCount)
+	right = make([]sbvhRef, 0, split.rightCount)
+	leftBox := split.left
+	rightBox := split.right
+	nl := float64(split.leftCount)
+	nr := float64(split.rightCount)
+
+	for _, ref := range refs {
+		min := ref.box.Bounds[0].Component(split.axis)
+		max := ref.box.Bounds[1].Component(split.axis)
+		if max <= split.position {
+			left = append(left, ref)
+			continue
+		}
+		if min >= split.position {
+			right = append(right, ref)
+			continue
+		}
+
+		extendedLeft := leftBox.Add(ref.box)
+		extendedRight := rightBox.Add(ref.box)
+		splitCost := leftBox.Surface()*nl + rightBox.Surface()*nr
+		leftCost := extendedLeft.Surface()*nl + rightBox.Surface()*(nr-1)
+		rightCost := leftBox.Surface()*(nl-1) + extendedRight.Surface()*nr
+		if leftCost < splitCost && leftCost <= rightCost {
+			left = append(left, ref)
+			leftBox = extendedLeft
+			nr--
+			continue
+		}
+		if rightCost < splitCost {
+			right = append(right, ref)
+			rightBox = extendedRight
+			nl--
+			continue
+		}
+
+		l, okLeft := b.clip(ref, split.axis, math.Inf(-1), split.position)
+		r, okRight := b.clip(ref, split.axis, split.position, math.Inf(1))
+		if okLeft {
+			left = append(left, sbvhRef{pId: ref.pId, box: l})
+		}
+		if okRight {
+			right = append(right, sbvhRef{pId: ref.pId, box: r})
+		}
+
+		// Never lose a primitive because of floating point errors while clipping
+		if !okLeft && !okRight {
+			if ref.box.Barycenter.Component(split.axis) < split.position {
+				left = append(left, ref)
+			} else {
+				right = append(right, ref)
+			}
+		}
+	}
+
+	return left, right
+}
+
+// Clips the reference to the slab [lo, hi] along the given axis
+func (b *SBVHBuilder) clip(ref sbvhRef, axis int, lo, hi float64) (scene.AABB, bool) {
+	lo = math.Max(lo, ref.box.Bounds[0].Component(axis))
+	hi = math.Min(hi, ref.box.Bounds[1].Component(axis))
+	if lo > hi {
+		return scene.AABB{}, false
+	}
+
+	slab := scene.NewAABB(ref.box.Bounds[0].WithComponent(axis, lo), ref.box.Bounds[1].WithComponent(axis, hi))
+	if c, ok := b.primitives[ref.pId].(clippable); ok {
+		return c.ClippedBounding(slab)
+	}
+	return slab, true
+}
+
+func spatialBin(value, lo, width float64, bins int) int {
+	i := int((value - lo) / width)
+	if i >= bins {
+		return bins - 1
+	}
+	if i < 0 {
+		return 0
+	}
+	return i
+}
+
+// Computes the bounding box of the given references and the bounding box of their centroids
+func enclosingRefs(refs []sbvhRef) (bounding scene.AABB, centroids scene.AABB) {
+	bounding = refs[0].box
+	min := bounding.Barycenter
+	max := bounding.Barycenter
+	for _, ref := range refs[1:] {
+		bounding = bounding.Add(ref.box)
+		min = m.MinVec(min, ref.box.Barycenter)
+		max = m.MaxVec(max, ref.box.Barycenter)
+	}
+	return bounding, scene.NewAABB(min, max)
+}
@@ -0,0 +1,54 @@
+package bvh_test
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSBVH(t *testing.T) {
+	// Long, thin diagonal triangles, whose bounding boxes overlap each other almost entirely
+	thin := make([]scene.Primitive, 200)
+	for i := range thin {
+		x := float64(i) * 0.05
+		thin[i] = scene.NewTriangleWithoutNormals(m.NewVector3(x, 0, 0), m.NewVector3(x+10, 10, 0), m.NewVector3(x+0.05, 0, 0.05))
+	}
+	mat := make([]scene.Material, len(thin))
+
+	// Without spatial splits, the builder only performs object splits.
+	// Clipped references in leaves must still be hit wherever their primitive is hit
+	objectSplits := bvh.NewSBVHBuilder(bvh.DEFAULT_SAH_BINS, bvh.DEFAULT_MAX_LEAF_SIZE, math.Inf(1), runtime.NumCPU())
+	spatialSplits := bvh.NewSBVHBuilder(bvh.DEFAULT_SAH_BINS, bvh.DEFAULT_MAX_LEAF_SIZE, 0, runtime.NumCPU())
+	objectTree := objectSplits.Build(thin, mat)
+	spatialTree := spatialSplits.Build(thin, mat)
+	requireBruteForceHits(t, objectTree, thin)
+	requireBruteForceHits(t, spatialTree, thin)
+
+	// Splitting the triangles into short pieces removes most of the overlap, which object splits cannot do
+	require.Less(t, spatialTree.Cost(1, 1), objectTree.Cost(1, 1)/2)
+	require.Greater(t, spatialTree.Stats().References, len(thin))
+
+	// Spatial splits cannot separate identical or degenerate primitives, so they must not duplicate them forever
+	identical := make([]scene.Primitive, 100)
+	points := make([]scene.Primitive, 100)
+	for i := range identical {
+		identical[i] = scene.NewTriangleWithoutNormals(m.NewVector3(0, 0, 0), m.NewVector3(1, 0, 0), m.NewVector3(0, 1, 0))
+		points[i] = scene.NewTriangleWithoutNormals(m.NewVector3(1, 1, 1), m.NewVector3(1, 1, 1), m.NewVector3(1, 1, 1))
+	}
+	identicalTree := spatialSplits.Build(identical, make([]scene.Material, len(identical)))
+	requireBruteForceHits(t, identicalTree, identical)
+	sah := bvh.NewSAHBuilder(bvh.DEFAULT_SAH_BINS, bvh.DEFAULT_MAX_LEAF_SIZE, runtime.NumCPU())
+	require.Equal(t, sah.Build(identical, make([]scene.Material, len(identical))).Cost(1, 1), identicalTree.Cost(1, 1))
+	spatialSplits.Build(points, make([]scene.Material, len(points)))
+
+	// Expensive traversals result in fewer, larger leaves
+	spatialSplits.Cost = bvh.CostModel{Traversal: 100, Intersection: 1}
+	leaves := spatialSplits.Build(thin, mat).Stats().Leaves
+	spatialSplits.Cost = bvh.CostModel{Traversal: 1, Intersection: 100}
+	require.Less(t, leaves, spatialSplits.Build(thin, mat).Stats().Leaves)
+}
@@ -0,0 +1,307 @@
+package bvh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+const (
+	FORMAT_VERSION = 2
+	formatMagic    = "GBVH"
+
+	leafTag   = 1
+	branchTag = 2
+
+	maxLoadDepth = 1 << 12 // Guards against corrupted files, valid trees are far shallower
+)
+
+var (
+	ErrHashMismatch       = errors.New("bvh was built from different primitives")
+	ErrSettingsMismatch   = errors.New("bvh was built with different settings")
+	ErrUnsupportedVersion = errors.New("unsupported bvh format version")
+)
+
+// Writes the tree in a versioned binary format. The header contains a hash of the primitives and of the settings,
+// so a loaded tree can be validated against the scene and the builder configuration. Settings is an arbitrary
+// description of everything that affects the tree, e.g. the builder and its parameters.
+// Primitives and materials themselves are not written.
+func (bvh *BVH) Write(w io.Writer, settings string) error {
+	e := encoder{w: bufio.NewWriter(w)}
+	e.bytes([]byte(formatMagic))
+	e.uint32(FORMAT_VERSION)
+	e.uint64(HashPrimitives(bvh.primitives))
+	e.uint64(hashSettings(settings))
+	e.uint64(uint64(len(bvh.primitives)))
+	e.bool(bvh.splitReferences)
+	e.bool(bvh.root != nil)
+	if bvh.root != nil {
+		e.node(bvh.root)
+	}
+
+	if e.err != nil {
+		return fmt.Errorf("failed to write bvh: %w", e.err)
+	}
+	if err := e.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write bvh: %w", err)
+	}
+	return nil
+}
+
+// Restores a tree written by BVH.Write for the given primitives and settings without rebuilding it.
+// Returns ErrHashMismatch if the tree was built from other primitives and ErrSettingsMismatch if it was built
+// with other settings. The structure of the loaded tree is checked with BVH.Validate.
+func Load(r io.Reader, p []scene.Primitive, m []scene.Material, settings string) (*BVH, error) {
+	d := decoder{r: bufio.NewReader(r), primitives: len(p)}
+	if magic := string(d.bytes(len(formatMagic))); d.err == nil && magic != formatMagic {
+		return nil, fmt.Errorf("failed to load bvh: invalid header")
+	}
+	if version := d.uint32(); d.err == nil && version != FORMAT_VERSION {
+		return nil, fmt.Errorf("failed to load bvh: %w %d", ErrUnsupportedVersion, version)
+	}
+	hash := d.uint64()
+	settingsHash := d.uint64()
+	count := d.uint64()
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to load bvh: %w", d.err)
+	}
+	if count != uint64(len(p)) || hash != HashPrimitives(p) {
+		return nil, ErrHashMismatch
+	}
+	if settingsHash != hashSettings(settings) {
+		return nil, ErrSettingsMismatch
+	}
+
+	bvh := &BVH{primitives: p, materials: m}
+	bvh.splitReferences = d.bool()
+	if d.bool() {
+		bvh.root = d.node(0)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to load bvh: %w", d.err)
+	}
+
+	for id, prim := range p {
+		if prim == nil {
+			bvh.free = append(bvh.free, id)
+		}
+	}
+
+	// The decoder only checks the primitive ids, the bounding boxes and references are checked here
+	if err := bvh.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to load bvh: %w", err)
+	}
+	return bvh, nil
+}
+
+// Hashes the bounding boxes of the primitives in order. Removed primitives are hashed as empty slots
+func HashPrimitives(p []scene.Primitive) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 0, 49)
+	for _, prim := range p {
+		buf = buf[:0]
+		if prim == nil {
+			buf = append(buf, 0)
+		} else {
+			buf = append(buf, 1)
+			box := prim.Bounding()
+			for _, v := range box.Bounds {
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.X))
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Y))
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Z))
+			}
+		}
+		h.Write(buf)
+	}
+	return h.Sum64()
+}
+
+func hashSettings(settings string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(settings))
+	return h.Sum64()
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	buf [8]byte
+	err error
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.bytes([]byte{1})
+	} else {
+		e.bytes([]byte{0})
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(e.buf[:4], v)
+	e.bytes(e.buf[:4])
+}
+
+func (e *encoder) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:], v)
+	e.bytes(e.buf[:])
+}
+
+func (e *encoder) vector(v m.Vector3) {
+	e.uint64(math.Float64bits(v.X))
+	e.uint64(math.Float64bits(v.Y))
+	e.uint64(math.Float64bits(v.Z))
+}
+
+// Writes the subtree in pre-order
+func (e *encoder) node(n *node) {
+	if n.isLeaf {
+		e.bytes([]byte{leafTag})
+	} else {
+		e.bytes([]byte{branchTag})
+	}
+	e.vector(n.aabb.Bounds[0])
+	e.vector(n.aabb.Bounds[1])
+
+	if n.isLeaf {
+		e.uint32(uint32(len(n.pIds)))
+		for _, id := range n.pIds {
+			e.uint32(uint32(id))
+		}
+		return
+	}
+
+	e.uint32(uint32(len(n.children)))
+	for _, child := range n.children {
+		e.node(child)
+	}
+}
+
+type decoder struct {
+	r          *bufio.Reader
+	buf        [8]byte
+	err        error
+	primitives int // Number of primitives, used to validate the primitive ids
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return d.buf[:0]
+	}
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	var b byte
+	b, d.err = d.r.ReadByte()
+	return b
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() == 1
+}
+
+func (d *decoder) uint32() uint32 {
+	if d.err != nil {
+		return 0
+	}
+	_, d.err = io.ReadFull(d.r, d.buf[:4])
+	return binary.LittleEndian.Uint32(d.buf[:4])
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	_, d.err = io.ReadFull(d.r, d.buf[:])
+	return binary.LittleEndian.Uint64(d.buf[:])
+}
+
+func (d *decoder) vector() m.Vector3 {
+	x := math.Float64frombits(d.uint64())
+	y := math.Float64frombits(d.uint64())
+	z := math.Float64frombits(d.uint64())
+	return m.NewVector3(x, y, z)
+}
+
+// Reads a subtree in pre-order, returns nil if the data is invalid
+func (d *decoder) node(depth int) *node {
+	if depth > maxLoadDepth {
+		d.fail("tree exceeds maximum depth of %d", maxLoadDepth)
+		return nil
+	}
+
+	tag := d.byte()
+	min := d.vector()
+	max := d.vector()
+	count := int(d.uint32())
+	if d.err != nil {
+		return nil
+	}
+
+	switch tag {
+	case leafTag:
+		if count == 0 {
+			d.fail("leaf without primitives")
+			return nil
+		}
+		if count > d.primitives {
+			d.fail("leaf references %d of %d primitives", count, d.primitives)
+			return nil
+		}
+		pIds := make([]primitiveId, count)
+		for i := range pIds {
+			pIds[i] = int(d.uint32())
+			if d.err == nil && pIds[i] >= d.primitives {
+				d.fail("invalid primitive id %d", pIds[i])
+			}
+		}
+		leaf := newLeaf(pIds)
+		leaf.aabb = scene.NewAABB(min, max)
+		return leaf
+
+	case branchTag:
+		if count == 0 {
+			d.fail("branch without children")
+			return nil
+		}
+		branch := newBranch(0)
+		branch.aabb = scene.NewAABB(min, max)
+		for i := 0; i < count && d.err == nil; i++ {
+			child := d.node(depth + 1)
+			if child == nil {
+				return nil
+			}
+			branch.children = append(branch.children, child)
+			child.parent = branch
+		}
+		return branch
+
+	default:
+		d.fail("invalid node tag %d", tag)
+		return nil
+	}
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
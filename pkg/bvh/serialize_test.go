@@ -0,0 +1,103 @@
+package bvh_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLoad(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{Albedo: scene.NewColor(1, 0, 0)})
+	p, mat := s.CollectPrimitives()
+	settings := "test"
+
+	phr := bvh.NewPHRBuilder(0.5, 6, 4, runtime.NumCPU())
+	sbvh := bvh.NewDefaultSBVHBuilder()
+	trees := map[string]*bvh.BVH{
+		"lbvh":  bvh.DefaultLBVH(p, mat, runtime.NumCPU()),
+		"phr-4": phr.BuildFromLBVH(p, mat),
+		"sbvh":  sbvh.Build(p, mat),
+	}
+
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			require.NoError(t, tree.Write(&buf, settings))
+			data := buf.Bytes()
+
+			loaded, err := bvh.Load(bytes.NewReader(data), p, mat, settings)
+			require.NoError(t, err)
+			require.Equal(t, tree.Cost(1, 1), loaded.Cost(1, 1))
+
+			r := rand.New(rand.NewSource(0))
+			for i := 0; i < 1000; i++ {
+				origin := m.NewRandomVector(-3, 3, r)
+				ray := m.NewRay(origin, m.NewRandomVector(-1, 1, r).Sub(origin))
+
+				expected := scene.Hit{}
+				actual := scene.Hit{}
+				ok := tree.ClosestHit(ray, 0.001, math.Inf(1), &expected)
+				require.Equal(t, ok, loaded.ClosestHit(ray, 0.001, math.Inf(1), &actual))
+				if ok {
+					require.Equal(t, expected.T, actual.T)
+				}
+			}
+
+			_, err = bvh.Load(bytes.NewReader(data[:len(data)/2]), p, mat, settings)
+			require.Error(t, err)
+		})
+	}
+
+	buf := bytes.Buffer{}
+	require.NoError(t, trees["lbvh"].Write(&buf, settings))
+
+	moved := make([]scene.Primitive, len(p))
+	for i, prim := range p {
+		moved[i] = prim.Transformed(m.Translate(1, 0, 0))
+	}
+	_, err = bvh.Load(bytes.NewReader(buf.Bytes()), moved, mat, settings)
+	require.ErrorIs(t, err, bvh.ErrHashMismatch)
+
+	_, err = bvh.Load(bytes.NewReader(buf.Bytes()), p[1:], mat[1:], settings)
+	require.ErrorIs(t, err, bvh.ErrHashMismatch)
+
+	// The root of a single primitive is a leaf, which is written last as its primitive count and the primitive id.
+	// Dropping the id and setting the count to 0 results in an empty leaf
+	single := bvh.DefaultLBVH(p[:1], mat[:1], runtime.NumCPU())
+	buf.Reset()
+	require.NoError(t, single.Write(&buf, settings))
+	empty := buf.Bytes()
+	empty = empty[:len(empty)-4]
+	copy(empty[len(empty)-4:], []byte{0, 0, 0, 0})
+	_, err = bvh.Load(bytes.NewReader(empty), p[:1], mat[:1], settings)
+	require.Error(t, err)
+
+	// Leaf bounds that do not enclose the primitive are only detected by validating the loaded tree.
+	// The bounds of the leaf precede its primitive count and id
+	buf.Reset()
+	require.NoError(t, single.Write(&buf, settings))
+	shifted := buf.Bytes()
+	binary.LittleEndian.PutUint64(shifted[len(shifted)-8-48:], math.Float64bits(1e9))
+	_, err = bvh.Load(bytes.NewReader(shifted), p[:1], mat[:1], settings)
+	require.ErrorContains(t, err, "does not enclose")
+
+	buf.Reset()
+	require.NoError(t, trees["lbvh"].Write(&buf, settings))
+	_, err = bvh.Load(bytes.NewReader(buf.Bytes()), p, mat, "other")
+	require.ErrorIs(t, err, bvh.ErrSettingsMismatch)
+
+	data := buf.Bytes()
+	data[4] = bvh.FORMAT_VERSION + 1
+	_, err = bvh.Load(bytes.NewReader(data), p, mat, settings)
+	require.ErrorIs(t, err, bvh.ErrUnsupportedVersion)
+}
@@ -0,0 +1,187 @@
+package bvh
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Quality report of a BVH
+type Stats struct {
+	Nodes      int `json:"nodes"`
+	Leaves     int `json:"leaves"`
+	EmptyNodes int `json:"emptyNodes"` // Leaves without primitives and branches without children
+	Primitives int `json:"primitives"`
+	References int `json:"references"` // Primitive references in leaves, exceeds Primitives for spatial splits
+
+	MaxDepth          int   `json:"maxDepth"`
+	DepthHistogram    []int `json:"depthHistogram"`    // Number of leaves at each depth
+	LeafSizeHistogram []int `json:"leafSizeHistogram"` // Number of leaves with each primitive count
+
+	SAH            float64 `json:"sah"`
+	EPO            float64 `json:"epo"`            // End-point overlap (Aila et al. 2013), only accounts for clippable primitives
+	SiblingOverlap float64 `json:"siblingOverlap"` // Surface of pairwise overlaps of sibling boxes relative to the root surface
+
+	MemoryBytes int `json:"memoryBytes"` // Estimated size of nodes and primitive references, excluding the primitives
+}
+
+// Implemented by primitives that can compute the area of their part inside a box
+type areaClippable interface {
+	ClippedArea(box scene.AABB) float64
+}
+
+func (bvh *BVH) Stats() Stats {
+	stats := Stats{
+		SAH: bvh.Cost(sahTraversalCost, sahIntersectionCost),
+	}
+	for _, p := range bvh.primitives {
+		if p != nil {
+			stats.Primitives++
+		}
+	}
+	stats.MemoryBytes = len(bvh.primitives) * int(unsafe.Sizeof(scene.Primitive(nil))+unsafe.Sizeof(scene.Material(nil)))
+
+	if bvh.root == nil {
+		return stats
+	}
+
+	bvh.root.collectStats(&stats, 0)
+	stats.SiblingOverlap /= bvh.root.aabb.Surface()
+	stats.EPO = bvh.endPointOverlap()
+	return stats
+}
+
+func (n *node) collectStats(stats *Stats, depth int) {
+	stats.Nodes++
+	stats.MemoryBytes += int(unsafe.Sizeof(*n)) + cap(n.children)*int(unsafe.Sizeof(n)) + cap(n.pIds)*int(unsafe.Sizeof(primitiveId(0)))
+
+	if n.isLeaf {
+		stats.Leaves++
+		stats.References += len(n.pIds)
+		if len(n.pIds) == 0 {
+			stats.EmptyNodes++
+		}
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+		stats.DepthHistogram = increment(stats.DepthHistogram, depth)
+		stats.LeafSizeHistogram = increment(stats.LeafSizeHistogram, len(n.pIds))
+		return
+	}
+
+	if len(n.children) == 0 {
+		stats.EmptyNodes++
+	}
+	for i, a := range n.children {
+		for _, b := range n.children[i+1:] {
+			if overlap, ok := a.aabb.Intersect(b.aabb); ok {
+				stats.SiblingOverlap += overlap.Surface()
+			}
+		}
+	}
+
+	for _, child := range n.children {
+		child.collectStats(stats, depth+1)
+	}
+}
+
+func increment(histogram []int, i int) []int {
+	for len(histogram) <= i {
+		histogram = append(histogram, 0)
+	}
+	histogram[i]++
+	return histogram
+}
+
+// Sums the area of all primitive parts that lie inside nodes which do not contain the primitive in their subtree,
+// weighted by the cost of the node and normalized by the total primitive area
+func (bvh *BVH) endPointOverlap() float64 {
+	// Nodes contain a primitive in their subtree if their leaf range includes a leaf referencing it
+	ranges := make(map[*node]leafRange)
+	leaves := 0
+	bvh.root.collectLeafRanges(ranges, &leaves)
+	leavesOf := make([][]int, len(bvh.primitives))
+	for n, r := range ranges {
+		if n.isLeaf {
+			for _, id := range n.pIds {
+				leavesOf[id] = append(leavesOf[id], r.first)
+			}
+		}
+	}
+	for _, l := range leavesOf {
+		sort.Ints(l)
+	}
+
+	mutex := sync.Mutex{}
+	overlap := 0.0
+	total := 0.0
+	parallelBatches(len(bvh.primitives), runtime.GOMAXPROCS(0), func(start, end int) {
+		batchOverlap := 0.0
+		batchTotal := 0.0
+		for id := start; id < end; id++ {
+			p, ok := bvh.primitives[id].(areaClippable)
+			if !ok {
+				continue
+			}
+			box := bvh.primitives[id].Bounding()
+			batchTotal += p.ClippedArea(box)
+			batchOverlap += bvh.root.overlap(p, box, ranges, leavesOf[id])
+		}
+
+		mutex.Lock()
+		overlap += batchOverlap
+		total += batchTotal
+		mutex.Unlock()
+	})
+
+	if total == 0 {
+		return 0
+	}
+	return overlap / total
+}
+
+// Leaves are numbered in depth-first order, so the leaves in the subtree of a node are numbered first to end-1
+type leafRange struct {
+	first, end int
+}
+
+func (n *node) collectLeafRanges(ranges map[*node]leafRange, next *int) {
+	first := *next
+	if n.isLeaf {
+		*next++
+	}
+	for _, child := range n.children {
+		child.collectLeafRanges(ranges, next)
+	}
+	ranges[n] = leafRange{first, *next}
+}
+
+// Leaves are the sorted numbers of the leaves referencing the primitive
+func (n *node) overlap(p areaClippable, box scene.AABB, ranges map[*node]leafRange, leaves []int) float64 {
+	if !n.aabb.Overlaps(box) {
+		return 0
+	}
+
+	sum := 0.0
+	if !ranges[n].containsAny(leaves) {
+		cost := sahTraversalCost
+		if n.isLeaf {
+			cost = sahIntersectionCost * float64(len(n.pIds))
+		}
+		sum += cost * p.ClippedArea(n.aabb)
+	}
+
+	for _, child := range n.children {
+		sum += child.overlap(p, box, ranges, leaves)
+	}
+	return sum
+}
+
+// Returns true if one of the sorted leaf numbers lies in the range
+func (r leafRange) containsAny(leaves []int) bool {
+	i := sort.SearchInts(leaves, r.first)
+	return i < len(leaves) && leaves[i] < r.end
+}
@@ -0,0 +1,52 @@
+package bvh_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	p, mat := s.CollectPrimitives()
+
+	lbvh := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	builder := bvh.NewDefaultSBVHBuilder()
+	sbvh := builder.Build(p, mat)
+
+	for name, tree := range map[string]*bvh.BVH{"lbvh": lbvh, "sbvh": sbvh} {
+		t.Run(name, func(t *testing.T) {
+			stats := tree.Stats()
+			require.Equal(t, len(p), stats.Primitives)
+			require.Equal(t, 2*stats.Leaves-1, stats.Nodes)
+			require.Zero(t, stats.EmptyNodes)
+			require.Equal(t, tree.Cost(1, 1), stats.SAH)
+			require.Greater(t, stats.EPO, 0.0)
+			require.Greater(t, stats.SiblingOverlap, 0.0)
+			require.Greater(t, stats.MemoryBytes, 0)
+			require.Len(t, stats.DepthHistogram, stats.MaxDepth+1)
+
+			leaves, references := 0, 0
+			for size, count := range stats.LeafSizeHistogram {
+				leaves += count
+				references += size * count
+			}
+			require.Equal(t, stats.Leaves, leaves)
+			require.Equal(t, stats.References, references)
+
+			leaves = 0
+			for _, count := range stats.DepthHistogram {
+				leaves += count
+			}
+			require.Equal(t, stats.Leaves, leaves)
+		})
+	}
+
+	require.Equal(t, len(p), lbvh.Stats().References)
+	require.Greater(t, sbvh.Stats().References, len(p))
+}
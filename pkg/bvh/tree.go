@@ -0,0 +1,155 @@
+package bvh
+
+import (
+	"errors"
+
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Objects indexed by a Tree. Objects that also implement scene.Intersectable can be hit by rays,
+// objects with a ClosestPoint(m.Vector3) m.Vector3 method are measured exactly by distance queries.
+type Bounded interface {
+	Bounding() scene.AABB
+}
+
+// BVH over arbitrary objects, e.g. points, lights or game objects. The objects are wrapped into primitives,
+// so all builders, queries and updates of the BVH can be used. Ids of objects are their index in the input slice.
+type Tree[T Bounded] struct {
+	bvh     *BVH
+	objects []*treeObject[T]
+}
+
+// Builds the tree with the given builder, e.g. DefaultLBVH or the BuildFromLBVH method of a PhrBuilder.
+// Builders are passed no materials. Returns an error if no builder is given
+func NewTree[T Bounded](objects []T, build BuildFunction) (*Tree[T], error) {
+	if build == nil {
+		return nil, errors.New("tree requires a build function")
+	}
+
+	wrapped := make([]*treeObject[T], len(objects))
+	prims := make([]scene.Primitive, len(objects))
+	for i, object := range objects {
+		wrapped[i] = &treeObject[T]{object: object, id: i, box: object.Bounding()}
+		prims[i] = wrapped[i]
+	}
+
+	return &Tree[T]{
+		bvh:     build(prims, make([]scene.Material, len(prims))),
+		objects: wrapped,
+	}, nil
+}
+
+// Underlying BVH, e.g. to compute statistics or validate it. Its primitives are not the objects of the tree
+func (t *Tree[T]) BVH() *BVH {
+	return t.bvh
+}
+
+// Returns the object with the given id and false if it was removed
+func (t *Tree[T]) Object(id int) (T, bool) {
+	if id < 0 || id >= len(t.objects) || t.objects[id] == nil {
+		var zero T
+		return zero, false
+	}
+	return t.objects[id].object, true
+}
+
+// Returns the closest object hit by the ray and false if no object implementing scene.Intersectable was hit.
+// The PrimitiveId of the hit is the id of the object
+func (t *Tree[T]) ClosestHit(ray m.Ray, tMin, tMax float64, hitOut *scene.Hit) (T, bool) {
+	if !t.bvh.ClosestHit(ray, tMin, tMax, hitOut) {
+		var zero T
+		return zero, false
+	}
+	return t.objects[hitOut.PrimitiveId].object, true
+}
+
+// Appends the ids of all objects whose bounding boxes overlap the box to out
+func (t *Tree[T]) Overlapping(box scene.AABB, out []int) []int {
+	return t.bvh.Overlapping(box, out)
+}
+
+// Appends the ids of all objects with a distance of at most radius to the center to out
+func (t *Tree[T]) WithinSphere(center m.Vector3, radius float64, out []int) []int {
+	return t.bvh.WithinSphere(center, radius, out)
+}
+
+// Finds the object closest to the point within maxDistance, see BVH.NearestPrimitive
+func (t *Tree[T]) Nearest(point m.Vector3, maxDistance float64) (Nearest, bool) {
+	return t.bvh.NearestPrimitive(point, maxDistance)
+}
+
+// Adds an object to the tree without rebuilding it, see BVH.Insert. Returns the id of the object
+func (t *Tree[T]) Insert(object T) int {
+	wrapped := &treeObject[T]{object: object, box: object.Bounding()}
+	wrapped.id = t.bvh.Insert(wrapped, nil)
+	if wrapped.id == len(t.objects) {
+		t.objects = append(t.objects, wrapped)
+	} else {
+		t.objects[wrapped.id] = wrapped
+	}
+	return wrapped.id
+}
+
+// Removes the object from the tree, see BVH.Remove
+func (t *Tree[T]) Remove(id int) error {
+	if err := t.bvh.Remove(id); err != nil {
+		return err
+	}
+	t.objects[id] = nil
+	return nil
+}
+
+// Recomputes all bounding boxes after objects have moved, see BVH.Refit
+func (t *Tree[T]) Refit(threads int) error {
+	prims := make([]scene.Primitive, len(t.objects))
+	parallelBatches(len(t.objects), threads, func(start, end int) {
+		for i := start; i < end; i++ {
+			if t.objects[i] == nil {
+				continue
+			}
+			t.objects[i].box = t.objects[i].object.Bounding()
+			prims[i] = t.objects[i]
+		}
+	})
+	return t.bvh.Refit(prims, threads)
+}
+
+// Wraps an object into a primitive. The bounding box is cached, so moved objects are still found in the tree
+// until it is refitted
+type treeObject[T Bounded] struct {
+	object T
+	id     int
+	box    scene.AABB
+}
+
+func (o *treeObject[T]) Bounding() scene.AABB {
+	return o.box
+}
+
+func (o *treeObject[T]) Primitives() []scene.Primitive {
+	return []scene.Primitive{o}
+}
+
+// Required by scene.Primitive, but never called: primitives are only transformed when a scene node collects them,
+// and the wrapped objects are never part of a scene. Moved objects are updated with Tree.Refit instead.
+// Objects cannot be transformed generically, so the object is returned unchanged
+func (o *treeObject[T]) Transformed(m.Matrix4) scene.Primitive {
+	return o
+}
+
+func (o *treeObject[T]) Intersected(ray m.Ray, tMin, tMax float64, hitOut *scene.Hit) bool {
+	i, ok := any(o.object).(scene.Intersectable)
+	if !ok || !i.Intersected(ray, tMin, tMax, hitOut) {
+		return false
+	}
+	hitOut.PrimitiveId = o.id
+	return true
+}
+
+func (o *treeObject[T]) ClosestPoint(point m.Vector3) m.Vector3 {
+	if c, ok := any(o.object).(closestPointer); ok {
+		return c.ClosestPoint(point)
+	}
+	return o.box.ClosestPoint(point)
+}
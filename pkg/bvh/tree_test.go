@@ -0,0 +1,129 @@
+package bvh_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+type point struct {
+	position m.Vector3
+}
+
+func (p *point) Bounding() scene.AABB {
+	return scene.NewAABB(p.position, p.position)
+}
+
+// Intersectable, since the triangle is embedded
+type light struct {
+	*scene.Triangle
+	power float64
+}
+
+func TestTree(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	points := make([]*point, 1000)
+	for i := range points {
+		points[i] = &point{position: m.NewRandomVector(-10, 10, r)}
+	}
+
+	phr := bvh.NewDefaultPHRBuilder()
+	builders := map[string]bvh.BuildFunction{
+		"lbvh": func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+			return bvh.DefaultLBVH(p, m, runtime.NumCPU())
+		},
+		"phr": phr.BuildFromLBVH,
+	}
+
+	for name, build := range builders {
+		t.Run(name, func(t *testing.T) {
+			tree, err := bvh.NewTree(points, build)
+			require.NoError(t, err)
+			require.NoError(t, tree.BVH().Validate())
+
+			// Queries match a brute force search
+			center := m.NewVector3(1, 2, 3)
+			nearest, ok := tree.Nearest(center, math.Inf(1))
+			require.True(t, ok)
+			within := tree.WithinSphere(center, 5, nil)
+			expectedWithin := 0
+			for i, p := range points {
+				d := p.position.Distance(center)
+				require.GreaterOrEqual(t, d, nearest.Distance)
+				if d <= 5 {
+					expectedWithin++
+				}
+				if i == nearest.PrimitiveId {
+					require.Equal(t, d, nearest.Distance)
+				}
+			}
+			require.Len(t, within, expectedWithin)
+
+			// Points are never hit by rays
+			hit := scene.Hit{}
+			_, ok = tree.ClosestHit(m.NewRay(center, m.NewVector3(0, 0, 1)), 0, math.Inf(1), &hit)
+			require.False(t, ok)
+
+			// Moved points are found after refitting
+			for _, p := range points {
+				p.position = p.position.Add(m.NewVector3(100, 0, 0))
+			}
+			require.NoError(t, tree.Refit(runtime.NumCPU()))
+			require.NoError(t, tree.BVH().Validate())
+			nearest, ok = tree.Nearest(m.NewVector3(100, 0, 0), math.Inf(1))
+			require.True(t, ok)
+			object, ok := tree.Object(nearest.PrimitiveId)
+			require.True(t, ok)
+			require.Equal(t, points[nearest.PrimitiveId], object)
+
+			for _, p := range points {
+				p.position = p.position.Add(m.NewVector3(-100, 0, 0))
+			}
+		})
+	}
+}
+
+func TestTreeIntersection(t *testing.T) {
+	lights := []light{
+		{scene.NewTriangleWithoutNormals(m.NewVector3(-1, -1, -1), m.NewVector3(1, -1, -1), m.NewVector3(0, 1, -1)), 1},
+		{scene.NewTriangleWithoutNormals(m.NewVector3(-1, -1, -2), m.NewVector3(1, -1, -2), m.NewVector3(0, 1, -2)), 2},
+	}
+	tree, err := bvh.NewTree(lights, func(p []scene.Primitive, m []scene.Material) *bvh.BVH {
+		return bvh.DefaultLBVH(p, m, runtime.NumCPU())
+	})
+	require.NoError(t, err)
+
+	ray := m.NewRay(m.NewVector3(0, 0, 0), m.NewVector3(0, 0, -1))
+	hit := scene.Hit{}
+	closest, ok := tree.ClosestHit(ray, 0, math.Inf(1), &hit)
+	require.True(t, ok)
+	require.Equal(t, 1.0, closest.power)
+	require.InDelta(t, 1.0, hit.T, 1e-9)
+
+	// Objects can be removed and inserted, removed ids are reused
+	require.NoError(t, tree.Remove(0))
+	_, ok = tree.Object(0)
+	require.False(t, ok)
+	hit = scene.Hit{}
+	closest, ok = tree.ClosestHit(ray, 0, math.Inf(1), &hit)
+	require.True(t, ok)
+	require.Equal(t, 2.0, closest.power)
+
+	near := light{scene.NewTriangleWithoutNormals(m.NewVector3(-1, -1, -0.5), m.NewVector3(1, -1, -0.5), m.NewVector3(0, 1, -0.5)), 3}
+	require.Equal(t, 0, tree.Insert(near))
+	require.NoError(t, tree.BVH().Validate())
+	hit = scene.Hit{}
+	closest, ok = tree.ClosestHit(ray, 0, math.Inf(1), &hit)
+	require.True(t, ok)
+	require.Equal(t, 3.0, closest.power)
+	require.Len(t, tree.Overlapping(scene.NewAABB(m.NewVector3(-1, -1, -2), m.NewVector3(1, 1, -0.5)), nil), 2)
+
+	_, err = bvh.NewTree(lights, nil)
+	require.Error(t, err)
+}
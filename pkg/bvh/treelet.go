@@ -0,0 +1,192 @@
+package bvh
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	MIN_TREELET_SIZE = 3
+	MAX_TREELET_SIZE = 10 // The optimal topology is searched over all subsets of the treelet leaves, which grows exponentially
+)
+
+// Optimizes the tree in place by restructuring small treelets bottom-up (Karras and Aila 2013).
+// For every binary node, a treelet is formed by repeatedly expanding its leaf with the largest surface and then
+// replaced by the topology over the same treelet leaves that minimizes the SAH. Nodes are only treelet roots if
+// their subtree contains at least treeletSize primitives, this bound doubles with each iteration.
+// Returns the SAH cost of the tree before and after the optimization.
+func OptimizeTreelets(tree *BVH, treeletSize, iterations, threads int) (before, after float64) {
+	before = tree.Cost(sahTraversalCost, sahIntersectionCost)
+	if tree.root == nil || tree.root.isLeaf {
+		return before, before
+	}
+
+	if treeletSize < MIN_TREELET_SIZE {
+		treeletSize = MIN_TREELET_SIZE
+	}
+	if treeletSize > MAX_TREELET_SIZE {
+		treeletSize = MAX_TREELET_SIZE
+	}
+
+	for i := 0; i < iterations; i++ {
+		o := newTreeletOptimizer(tree.root, treeletSize)
+		minPrimitives := treeletSize << i
+
+		// Nodes of the same height never contain each other, so every level can be processed in parallel
+		for _, level := range o.levels[1:] {
+			parallelBatches(len(level), threads, func(start, end int) {
+				for _, n := range level[start:end] {
+					if len(n.children) == 2 && o.primitives[o.index[n]] >= minPrimitives {
+						o.restructure(n)
+					}
+				}
+			})
+		}
+	}
+
+	after = tree.Cost(sahTraversalCost, sahIntersectionCost)
+	return before, after
+}
+
+type treeletOptimizer struct {
+	size int
+
+	index      map[*node]int // Maps every node to its slot in the following slices
+	costs      []float64     // SAH cost of the subtree, not normalized by the surface of its root
+	primitives []int         // Number of primitives in the subtree
+	levels     [][]*node     // Nodes grouped by their height, leaves have height 0
+}
+
+func newTreeletOptimizer(root *node, size int) *treeletOptimizer {
+	o := &treeletOptimizer{
+		size:  size,
+		index: make(map[*node]int),
+	}
+	o.collect(root)
+	return o
+}
+
+// Traverses the subtree in post-order, records costs and primitive counts and returns the height of the node
+func (o *treeletOptimizer) collect(n *node) int {
+	height := 0
+	for _, child := range n.children {
+		if h := o.collect(child) + 1; h > height {
+			height = h
+		}
+	}
+
+	i := len(o.costs)
+	o.index[n] = i
+	o.costs = append(o.costs, 0)
+	o.primitives = append(o.primitives, 0)
+	o.update(n, i)
+
+	for len(o.levels) <= height {
+		o.levels = append(o.levels, nil)
+	}
+	o.levels[height] = append(o.levels[height], n)
+	return height
+}
+
+// Recomputes cost and primitive count of a node from its children
+func (o *treeletOptimizer) update(n *node, i int) {
+	if n.isLeaf {
+		o.costs[i] = sahIntersectionCost * n.aabb.Surface() * float64(len(n.pIds))
+		o.primitives[i] = len(n.pIds)
+		return
+	}
+
+	o.costs[i] = sahTraversalCost * n.aabb.Surface()
+	o.primitives[i] = 0
+	for _, child := range n.children {
+		c := o.index[child]
+		o.costs[i] += o.costs[c]
+		o.primitives[i] += o.primitives[c]
+	}
+}
+
+func (o *treeletOptimizer) restructure(root *node) {
+	// Form the treelet by expanding the treelet leaf with the largest surface
+	leaves := []*node{root.children[0], root.children[1]}
+	internals := []*node{root}
+	for len(leaves) < o.size {
+		best := -1
+		bestSurface := -1.0
+		for i, leaf := range leaves {
+			if !leaf.isLeaf && len(leaf.children) == 2 && leaf.aabb.Surface() > bestSurface {
+				best = i
+				bestSurface = leaf.aabb.Surface()
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		expanded := leaves[best]
+		internals = append(internals, expanded)
+		leaves[best] = expanded.children[0]
+		leaves = append(leaves, expanded.children[1])
+	}
+
+	if len(leaves) < MIN_TREELET_SIZE {
+		return
+	}
+
+	// Dynamic programming over all subsets of treelet leaves
+	// The subsets of a set are always smaller numbers, so they are processed before the set itself
+	full := 1<<len(leaves) - 1
+	costs := make([]float64, full+1)
+	splits := make([]int, full+1)
+	boxes := make([]sahBin, full+1)
+	for s := 1; s <= full; s++ {
+		lowest := s & -s
+		leaf := bits.TrailingZeros(uint(s))
+		boxes[s] = boxes[s^lowest]
+		boxes[s].add(leaves[leaf].aabb)
+
+		if s == lowest {
+			costs[s] = o.costs[o.index[leaves[leaf]]]
+			continue
+		}
+
+		// Enumerate all partitions, only consider those containing the lowest leaf to skip mirrored partitions
+		best := math.Inf(1)
+		for p := (s - 1) & s; p > 0; p = (p - 1) & s {
+			if p&lowest == 0 {
+				continue
+			}
+			if cost := costs[p] + costs[s^p]; cost < best {
+				best = cost
+				splits[s] = p
+			}
+		}
+		costs[s] = sahTraversalCost*boxes[s].bounding.Surface() + best
+	}
+
+	if costs[full] >= o.costs[o.index[root]] {
+		return
+	}
+
+	// Rebuild the treelet, reusing the internal nodes
+	free := internals[1:]
+	var build func(n *node, s int)
+	build = func(n *node, s int) {
+		p := splits[s]
+		for i, side := range [2]int{p, s ^ p} {
+			var child *node
+			if bits.OnesCount(uint(side)) == 1 {
+				child = leaves[bits.TrailingZeros(uint(side))]
+			} else {
+				child = free[len(free)-1]
+				free = free[:len(free)-1]
+				build(child, side)
+			}
+			n.addChild(child, i)
+		}
+
+		n.aabb = n.children[0].aabb.Add(n.children[1].aabb)
+		n.size = 0
+		o.update(n, o.index[n])
+	}
+	build(root, full)
+}
@@ -0,0 +1,70 @@
+package bvh_test
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimizeTreelets(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	s := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{})
+	suzanne, _ := s.CollectPrimitives()
+	random := randomTriangles(2000, rand.New(rand.NewSource(0)))
+
+	builders := map[string]func(p []scene.Primitive, mat []scene.Material) *bvh.BVH{
+		"lbvh": func(p []scene.Primitive, mat []scene.Material) *bvh.BVH {
+			return bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+		},
+		"ploc": func(p []scene.Primitive, mat []scene.Material) *bvh.BVH {
+			builder := bvh.NewDefaultPLOCBuilder()
+			return builder.Build(p, mat)
+		},
+		"sah": func(p []scene.Primitive, mat []scene.Material) *bvh.BVH {
+			builder := bvh.NewDefaultSAHBuilder()
+			return builder.Build(p, mat)
+		},
+	}
+
+	// Every treelet is only replaced by a cheaper topology, so no tree may get more expensive
+	for name, build := range builders {
+		t.Run(name, func(t *testing.T) {
+			for _, p := range [][]scene.Primitive{suzanne, random} {
+				for _, size := range []int{1, 5, 7, 20} {
+					tree := build(p, make([]scene.Material, len(p)))
+					cost := tree.Cost(1, 1)
+					before, after := bvh.OptimizeTreelets(tree, size, 3, runtime.NumCPU())
+					require.Equal(t, cost, before)
+					require.LessOrEqual(t, after, before+1e-9)
+					require.InDelta(t, tree.Cost(1, 1), after, 1e-9)
+					requireBruteForceHits(t, tree, p)
+				}
+			}
+		})
+	}
+
+	tree := bvh.DefaultLBVH(suzanne, make([]scene.Material, len(suzanne)), runtime.NumCPU())
+	before, after := bvh.OptimizeTreelets(tree, 7, 3, runtime.NumCPU())
+	require.Less(t, after, before)
+
+	// Trees without branches are left unchanged
+	single := bvh.DefaultLBVH(suzanne[:1], make([]scene.Material, 1), runtime.NumCPU())
+	before, after = bvh.OptimizeTreelets(single, 7, 3, runtime.NumCPU())
+	require.Equal(t, before, after)
+	requireBruteForceHits(t, single, suzanne[:1])
+}
+
+func randomTriangles(n int, r *rand.Rand) []scene.Primitive {
+	p := make([]scene.Primitive, n)
+	for i := range p {
+		corner := m.NewRandomVector(-10, 10, r)
+		p[i] = scene.NewTriangleWithoutNormals(corner, corner.Add(m.NewRandomVector(0, 1, r)), corner.Add(m.NewRandomVector(0, 1, r)))
+	}
+	return p
+}
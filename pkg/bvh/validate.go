@@ -0,0 +1,118 @@
+package bvh
+
+import (
+	"fmt"
+
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+// Checks the structure of the tree and returns an error describing the first violation found:
+// every primitive is referenced by exactly one leaf (at least one for spatial splits) and removed ones by none,
+// parent pointers match, children are enclosed by their parent, leaves are not empty and branches have at least two children.
+func (bvh *BVH) Validate() error {
+	return bvh.ValidateLimits(0, 0)
+}
+
+// Checks the tree like Validate and additionally that branches have at most maxWidth children and leaves reference
+// at most maxLeafSize primitives, e.g. after Collapse or for builders with a leaf size limit. Limits of 0 are not checked,
+// as most trees only guarantee them for the settings they were built with
+func (bvh *BVH) ValidateLimits(maxWidth, maxLeafSize int) error {
+	limits := validationLimits{maxWidth: maxWidth, maxLeafSize: maxLeafSize}
+	references := make([]int, len(bvh.primitives))
+	if bvh.root != nil {
+		if bvh.root.parent != nil {
+			return fmt.Errorf("root has a parent")
+		}
+		if err := bvh.root.validate(bvh, limits, references, 0); err != nil {
+			return err
+		}
+	}
+
+	for id, count := range references {
+		switch {
+		case bvh.primitives[id] == nil && count > 0:
+			return fmt.Errorf("removed primitive %d is referenced by %d leaves", id, count)
+		case bvh.primitives[id] != nil && count == 0:
+			return fmt.Errorf("primitive %d is not referenced by any leaf", id)
+		case count > 1 && !bvh.splitReferences:
+			return fmt.Errorf("primitive %d is referenced by %d leaves", id, count)
+		}
+	}
+	return nil
+}
+
+type validationLimits struct {
+	maxWidth    int
+	maxLeafSize int
+}
+
+func (n *node) validate(bvh *BVH, limits validationLimits, references []int, depth int) error {
+	if n.isLeaf {
+		if len(n.children) > 0 {
+			return fmt.Errorf("leaf at depth %d has %d children", depth, len(n.children))
+		}
+		if len(n.pIds) == 0 {
+			return fmt.Errorf("leaf at depth %d is empty", depth)
+		}
+		if limits.maxLeafSize > 0 && len(n.pIds) > limits.maxLeafSize {
+			return fmt.Errorf("leaf at depth %d references %d primitives, more than %d", depth, len(n.pIds), limits.maxLeafSize)
+		}
+
+		for i, id := range n.pIds {
+			if id < 0 || id >= len(bvh.primitives) {
+				return fmt.Errorf("leaf at depth %d references unknown primitive %d", depth, id)
+			}
+			for _, other := range n.pIds[:i] {
+				if other == id {
+					return fmt.Errorf("leaf at depth %d references primitive %d twice", depth, id)
+				}
+			}
+			references[id]++
+
+			// Removed primitives are reported by Validate
+			if bvh.primitives[id] == nil {
+				continue
+			}
+
+			// Leaves with split references only have to enclose the clipped part of the primitive
+			box := bvh.primitives[id].Bounding()
+			if bvh.splitReferences && !n.aabb.Overlaps(box) || !bvh.splitReferences && !encloses(n.aabb, box) {
+				return fmt.Errorf("leaf at depth %d does not enclose primitive %d", depth, id)
+			}
+		}
+		return nil
+	}
+
+	if len(n.pIds) > 0 {
+		return fmt.Errorf("branch at depth %d references %d primitives", depth, len(n.pIds))
+	}
+	if len(n.children) < 2 {
+		return fmt.Errorf("branch at depth %d has %d children", depth, len(n.children))
+	}
+	if limits.maxWidth > 0 && len(n.children) > limits.maxWidth {
+		return fmt.Errorf("branch at depth %d has %d children, more than %d", depth, len(n.children), limits.maxWidth)
+	}
+
+	for i, child := range n.children {
+		if child == nil {
+			return fmt.Errorf("branch at depth %d has no child at index %d", depth, i)
+		}
+		if child.parent != n {
+			return fmt.Errorf("child %d of branch at depth %d has a different parent", i, depth)
+		}
+		if !encloses(n.aabb, child.aabb) {
+			return fmt.Errorf("child %d of branch at depth %d is not enclosed by its parent", i, depth)
+		}
+		if err := child.validate(bvh, limits, references, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns true if inner lies completely inside outer
+func encloses(outer, inner scene.AABB) bool {
+	return outer.Bounds[0].X <= inner.Bounds[0].X && outer.Bounds[1].X >= inner.Bounds[1].X &&
+		outer.Bounds[0].Y <= inner.Bounds[0].Y && outer.Bounds[1].Y >= inner.Bounds[1].Y &&
+		outer.Bounds[0].Z <= inner.Bounds[0].Z && outer.Bounds[1].Z >= inner.Bounds[1].Z
+}
@@ -0,0 +1,37 @@
+package bvh_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	for name, p := range testInputs() {
+		t.Run(name, func(t *testing.T) {
+			mat := make([]scene.Material, len(p))
+			sah := bvh.NewDefaultSAHBuilder()
+			sbvh := bvh.NewDefaultSBVHBuilder()
+			ploc := bvh.NewDefaultPLOCBuilder()
+			require.NoError(t, sah.Build(p, mat).Validate())
+			require.NoError(t, sbvh.Build(p, mat).Validate())
+			require.NoError(t, ploc.Build(p, mat).Validate())
+		})
+	}
+
+	// Collapsed trees are only limited to the width they were collapsed to
+	p := testInputs()["random-1000"]
+	mat := make([]scene.Material, len(p))
+	wide := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+	wide.Collapse(4)
+	require.NoError(t, wide.ValidateLimits(4, 0))
+	require.Error(t, wide.ValidateLimits(3, 0))
+
+	sah := bvh.NewSAHBuilder(bvh.DEFAULT_SAH_BINS, 2, runtime.NumCPU())
+	tree := sah.Build(p, mat)
+	require.NoError(t, tree.ValidateLimits(2, 2))
+	require.Error(t, tree.ValidateLimits(2, 1))
+}
@@ -1,5 +1,7 @@
 package morton
 
+import "math"
+
 const MORTON_SIZE = 2097152                 // 2^21
 const MAX_MORTON_CODE = 9223372036854743495 // 2^63 => max 64bit 3D morton code with 21 bits for each dimension
 
@@ -19,6 +21,87 @@ func EncodeLookUp(x, y, z uint64) uint64 {
 	return out
 }
 
+// Compute the index of a given 3D point along a Hilbert curve with 21 bits for each dimension.
+// Consecutive indices are always neighbouring cells, unlike for morton codes (Skilling 2004, Programming the Hilbert curve)
+func EncodeHilbert(x, y, z uint64) uint64 {
+	p := [3]uint64{x & 0x1fffff, y & 0x1fffff, z & 0x1fffff}
+
+	// Undo excess work of the gray code
+	for q := uint64(1) << 20; q > 1; q >>= 1 {
+		mask := q - 1
+		for i := range p {
+			if p[i]&q != 0 {
+				p[0] ^= mask
+			} else {
+				t := (p[0] ^ p[i]) & mask
+				p[0] ^= t
+				p[i] ^= t
+			}
+		}
+	}
+
+	// Gray encode
+	p[1] ^= p[0]
+	p[2] ^= p[1]
+	var t uint64
+	for q := uint64(1) << 20; q > 1; q >>= 1 {
+		if p[2]&q != 0 {
+			t ^= q - 1
+		}
+	}
+	for i := range p {
+		p[i] ^= t
+	}
+
+	// The index is the interleaved transpose, starting with the most significant bit of x
+	return splitBy3(p[2]) | splitBy3(p[1])<<1 | splitBy3(p[0])<<2
+}
+
+const maxLayoutBits = 52 // Quantized coordinates with more bits are not exact as float64
+
+// Distribution of the 63 bits of a morton code among the axes of non-cubic bounds, so that the cells of the
+// quantization grid are as close to cubes as possible (Vinkler et al. 2017, Extended Morton Codes)
+type Layout struct {
+	Bits  [3]uint   // Number of bits per axis, quantized coordinates must be smaller than 1 << Bits[axis]
+	order [63]uint8 // Axis of every bit, starting with the most significant one
+}
+
+func NewLayout(width, height, depth float64) Layout {
+	extent := [3]float64{width, height, depth}
+	if width <= 0 && height <= 0 && depth <= 0 {
+		extent = [3]float64{1, 1, 1}
+	}
+
+	l := Layout{}
+	cell := func(axis int) float64 {
+		return math.Ldexp(extent[axis], -int(l.Bits[axis]))
+	}
+	for i := range l.order {
+		// Halve the largest cell extent, ties prefer z over y over x like EncodeCompute
+		axis := -1
+		for a := 2; a >= 0; a-- {
+			if l.Bits[a] < maxLayoutBits && (axis < 0 || cell(a) > cell(axis)) {
+				axis = a
+			}
+		}
+		l.order[i] = uint8(axis)
+		l.Bits[axis]++
+	}
+	return l
+}
+
+// Compute the morton code of quantized coordinates according to the layout
+func (l *Layout) Encode(x, y, z uint64) uint64 {
+	coords := [3]uint64{x, y, z}
+	shift := l.Bits
+	var out uint64 = 0
+	for _, axis := range l.order {
+		shift[axis]--
+		out = out<<1 | coords[axis]>>shift[axis]&1
+	}
+	return out
+}
+
 func splitBy3(a uint64) uint64 {
 	var x uint64 = a & 0x1fffff
 	x = (x | x<<32) & 0x1f00000000ffff
@@ -0,0 +1,54 @@
+package morton_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/internal/morton"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeHilbert(t *testing.T) {
+	// The curve starts at the origin, so the first 8^k indices fill the cube with side length 2^k
+	const size = 8
+	cells := make([][3]int, size*size*size)
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			for z := 0; z < size; z++ {
+				code := morton.EncodeHilbert(uint64(x), uint64(y), uint64(z))
+				assert.Less(t, code, uint64(len(cells)))
+				cells[code] = [3]int{x, y, z}
+			}
+		}
+	}
+
+	// Consecutive indices are neighbours
+	for i := 1; i < len(cells); i++ {
+		distance := 0
+		for axis := 0; axis < 3; axis++ {
+			d := cells[i][axis] - cells[i-1][axis]
+			distance += d * d
+		}
+		assert.Equal(t, 1, distance, "cells %v and %v", cells[i-1], cells[i])
+	}
+
+	max := uint64(morton.MORTON_SIZE - 1)
+	assert.Less(t, morton.EncodeHilbert(max, max, max), uint64(1)<<63)
+}
+
+func TestLayout(t *testing.T) {
+	// Cubic bounds result in regular morton codes
+	cube := morton.NewLayout(2, 2, 2)
+	assert.Equal(t, [3]uint{21, 21, 21}, cube.Bits)
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 1000; i++ {
+		x, y, z := r.Uint64()%morton.MORTON_SIZE, r.Uint64()%morton.MORTON_SIZE, r.Uint64()%morton.MORTON_SIZE
+		assert.Equal(t, morton.EncodeCompute(x, y, z), cube.Encode(x, y, z))
+	}
+
+	// Long axes receive more bits, axes without extent none
+	flat := morton.NewLayout(8, 2, 0)
+	assert.Equal(t, [3]uint{32, 31, 0}, flat.Bits)
+	assert.Equal(t, uint64(1)<<62, flat.Encode(1<<31, 0, 0))
+	assert.Equal(t, uint64(1)<<63-1, flat.Encode(1<<32-1, 1<<31-1, 0))
+}
@@ -40,16 +40,17 @@ func fillBuckets[T any](job SortJob[T], threads int) (buckets [][][]T, bucketFil
 		}
 
 		end := int(math.Min(float64(start+batchSize), float64(len(job.Items))))
-		bucketCollection = append(bucketCollection, make([][]T, job.NumberOfBuckets))
+		buckets := make([][]T, job.NumberOfBuckets)
+		bucketCollection = append(bucketCollection, buckets)
 		wg.Add(1)
-		go func(input []T, threadNumber int) {
+		go func(input []T) {
 			for _, item := range input {
 				index := job.BucketIndex(item)
-				bucketCollection[threadNumber][index] = append(bucketCollection[threadNumber][index], item)
+				buckets[index] = append(buckets[index], item)
 				atomic.AddInt32(&bucketEntries[index], 1)
 			}
 			wg.Done()
-		}(job.Items[start:end], i)
+		}(job.Items[start:end])
 	}
 	wg.Wait()
 	return bucketCollection, bucketEntries
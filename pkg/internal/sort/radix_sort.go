@@ -0,0 +1,109 @@
+package sort
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	radixBits    = 11
+	radixBuckets = 1 << radixBits
+
+	minRadixBatchSize = 4096 // Smaller inputs are not split among threads
+)
+
+// Sorts the given items in place by the lowest keyBits bits of their keys using a parallel least significant
+// digit radix sort. The sort is stable. Unlike BucketSort, the runtime does not depend on the distribution of the keys.
+func RadixSort[T any](items []T, key func(T) uint64, keyBits int, threads int) []T {
+	n := len(items)
+	if n < 2 {
+		return items
+	}
+
+	// Without threads there would be no batch to sort, so at least one is used
+	threads = max(threads, 1)
+	batches := int(math.Min(float64(threads), math.Ceil(float64(n)/minRadixBatchSize)))
+	batchSize := int(math.Ceil(float64(n) / float64(batches)))
+	batches = int(math.Ceil(float64(n) / float64(batchSize)))
+
+	src := items
+	dst := make([]T, n)
+	histograms := make([][radixBuckets]int, batches)
+	for shift := 0; shift < keyBits; shift += radixBits {
+		// The last digit may have fewer bits, higher bits of the keys are ignored
+		mask := uint64(radixBuckets - 1)
+		if keyBits-shift < radixBits {
+			mask = 1<<(keyBits-shift) - 1
+		}
+
+		parallelBatches(batches, batchSize, n, func(batch, start, end int) {
+			h := &histograms[batch]
+			*h = [radixBuckets]int{}
+			for _, item := range src[start:end] {
+				h[key(item)>>shift&mask]++
+			}
+		})
+
+		// All keys share the digit, so the pass would not change the order
+		if skipPass(histograms, n) {
+			continue
+		}
+
+		// Each batch writes its items with a given digit after those of all smaller digits and of previous batches,
+		// which keeps the sort stable
+		offset := 0
+		for d := 0; d < radixBuckets; d++ {
+			for b := range histograms {
+				count := histograms[b][d]
+				histograms[b][d] = offset
+				offset += count
+			}
+		}
+
+		parallelBatches(batches, batchSize, n, func(batch, start, end int) {
+			offsets := &histograms[batch]
+			for _, item := range src[start:end] {
+				d := key(item) >> shift & mask
+				dst[offsets[d]] = item
+				offsets[d]++
+			}
+		})
+		src, dst = dst, src
+	}
+
+	if &src[0] != &items[0] {
+		copy(items, src)
+	}
+	return items
+}
+
+func skipPass(histograms [][radixBuckets]int, n int) bool {
+	for d := 0; d < radixBuckets; d++ {
+		count := 0
+		for b := range histograms {
+			count += histograms[b][d]
+		}
+		if count == n {
+			return true
+		}
+		if count > 0 {
+			return false
+		}
+	}
+	return false
+}
+
+// Processes the batches [i * batchSize, (i + 1) * batchSize) of [0, n) concurrently
+func parallelBatches(batches, batchSize, n int, process func(batch, start, end int)) {
+	wg := sync.WaitGroup{}
+	wg.Add(batches)
+	for i := 0; i < batches; i++ {
+		start := i * batchSize
+		end := int(math.Min(float64(start+batchSize), float64(n)))
+		go func(batch int) {
+			process(batch, start, end)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,106 @@
+package sort_test
+
+import (
+	"math/rand"
+	"runtime"
+	gosort "sort"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/internal/sort"
+	"github.com/stretchr/testify/assert"
+)
+
+type pair struct {
+	key   uint64
+	index int
+}
+
+func pairKey(p pair) uint64 { return p.key }
+
+func TestRadixSort(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	inputs := map[string][]pair{
+		"empty":   {},
+		"single":  {{key: 1}},
+		"uniform": randomPairs(r, 100000, uniformKey),
+		"skewed":  randomPairs(r, 100000, skewedKey),
+		"equal":   randomPairs(r, 10000, func(*rand.Rand) uint64 { return 42 }),
+	}
+
+	for name, items := range inputs {
+		t.Run(name, func(t *testing.T) {
+			expected := make([]pair, len(items))
+			copy(expected, items)
+			gosort.SliceStable(expected, func(i, j int) bool { return expected[i].key < expected[j].key })
+
+			sort.RadixSort(items, pairKey, 63, runtime.GOMAXPROCS(0))
+			assert.Equal(t, expected, items)
+		})
+	}
+
+	// Only the given number of bits is sorted
+	items := []pair{{key: 0x101, index: 0}, {key: 0x001, index: 1}, {key: 0x100, index: 2}}
+	sort.RadixSort(items, pairKey, 8, 1)
+	assert.Equal(t, []pair{{key: 0x100, index: 2}, {key: 0x101, index: 0}, {key: 0x001, index: 1}}, items)
+
+	// Thread counts below 1 sort on a single thread
+	for _, threads := range []int{0, -1} {
+		items := randomPairs(r, 10000, uniformKey)
+		expected := make([]pair, len(items))
+		copy(expected, items)
+		gosort.SliceStable(expected, func(i, j int) bool { return expected[i].key < expected[j].key })
+		sort.RadixSort(items, pairKey, 63, threads)
+		assert.Equal(t, expected, items)
+	}
+}
+
+func BenchmarkSort(b *testing.B) {
+	r := rand.New(rand.NewSource(0))
+	const n = 1 << 20
+	distributions := map[string][]pair{
+		"uniform": randomPairs(r, n, uniformKey),
+		"skewed":  randomPairs(r, n, skewedKey),
+	}
+
+	for name, input := range distributions {
+		items := make([]pair, n)
+		b.Run(name+"/bucket", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(items, input)
+				job := sort.SortJob[pair]{
+					BucketIndex:     func(p pair) uint { return uint(p.key >> 51) },
+					Less:            func(a, c pair) bool { return a.key < c.key },
+					Items:           items,
+					NumberOfBuckets: 4096,
+				}
+				sort.BucketSort(job, runtime.GOMAXPROCS(0))
+			}
+		})
+		b.Run(name+"/radix", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(items, input)
+				sort.RadixSort(items, pairKey, 63, runtime.GOMAXPROCS(0))
+			}
+		})
+	}
+}
+
+func randomPairs(r *rand.Rand, n int, key func(*rand.Rand) uint64) []pair {
+	pairs := make([]pair, n)
+	for i := range pairs {
+		pairs[i] = pair{key: key(r), index: i}
+	}
+	return pairs
+}
+
+func uniformKey(r *rand.Rand) uint64 {
+	return r.Uint64() >> 1
+}
+
+// Most keys share their upper bits, like the Morton codes of a dense mesh in a large scene
+func skewedKey(r *rand.Rand) uint64 {
+	if r.Intn(10) == 0 {
+		return uniformKey(r)
+	}
+	return 1<<62 | r.Uint64()>>40
+}
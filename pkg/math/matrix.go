@@ -158,6 +158,13 @@ func (m Matrix4) Inverse() Matrix4 {
 	}
 }
 
+// Determinant of the upper left 3x3 matrix, which is negative if the transformation mirrors
+func (m Matrix4) LinearDeterminant() float64 {
+	return m[0]*(m[5]*m[10]-m[6]*m[9]) -
+		m[1]*(m[4]*m[10]-m[6]*m[8]) +
+		m[2]*(m[4]*m[9]-m[5]*m[8])
+}
+
 func (m Matrix4) Transpose() Matrix4 {
 	return Matrix4{
 		m[0], m[4], m[8], m[12],
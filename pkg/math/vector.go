@@ -108,6 +108,31 @@ func (p Vector3) Spread() (float64, float64, float64) {
 	return p.X, p.Y, p.Z
 }
 
+// Returns the X, Y or Z component for axis 0, 1 or 2
+func (v Vector3) Component(axis int) float64 {
+	switch axis {
+	case 0:
+		return v.X
+	case 1:
+		return v.Y
+	default:
+		return v.Z
+	}
+}
+
+// Returns a copy of the vector with the component of the given axis replaced
+func (v Vector3) WithComponent(axis int, value float64) Vector3 {
+	switch axis {
+	case 0:
+		v.X = value
+	case 1:
+		v.Y = value
+	default:
+		v.Z = value
+	}
+	return v
+}
+
 type Vector4 struct {
 	x, y, z, w float64
 }
@@ -13,7 +13,7 @@ import (
 )
 
 type Renderer interface {
-	RenderBvh(*bvh.BVH, *Camera, Buffer)
+	RenderBvh(bvh.Traversable, *Camera, Buffer)
 }
 
 type ImageRenderer struct {
@@ -24,6 +24,10 @@ type ImageRenderer struct {
 	MissShader       MissShader
 
 	Sampling Sampling
+
+	// Primary rays of square tiles with this width are traced as packets, if supported by the BVH.
+	// Secondary rays are always traced individually. 0 disables packets
+	PacketSize int
 }
 
 func NewHeatmapRenderer(threshold int) *ImageRenderer {
@@ -36,6 +40,16 @@ func NewHeatmapRenderer(threshold int) *ImageRenderer {
 	}
 }
 
+func NewAmbientOcclusionRenderer(samples int, distance float64) *ImageRenderer {
+	return &ImageRenderer{
+		NumCPU:           runtime.GOMAXPROCS(0),
+		Spp:              1,
+		ClosestHitShader: &AmbientOcclusionShader{Samples: samples, Distance: distance},
+		MissShader:       &DefaultMissShader{Color: scene.NewColor(1, 1, 1)},
+		Sampling:         RandomSampling,
+	}
+}
+
 func NewDefaultRenderer() *ImageRenderer {
 	return &ImageRenderer{
 		NumCPU:           runtime.GOMAXPROCS(0),
@@ -47,12 +61,17 @@ func NewDefaultRenderer() *ImageRenderer {
 }
 
 type context struct {
-	bvh   *bvh.BVH
+	bvh   bvh.Traversable
 	rand  *rand.Rand
 	depth int
 }
 
-func (r *ImageRenderer) RenderBvh(b *bvh.BVH, cam *Camera, buff Buffer) {
+func (r *ImageRenderer) RenderBvh(b bvh.Traversable, cam *Camera, buff Buffer) {
+	if p, ok := b.(bvh.PacketTraversable); ok && r.PacketSize > 1 {
+		r.renderPackets(p, cam, buff)
+		return
+	}
+
 	jobs := make(chan int, buff.Height())
 	wg := sync.WaitGroup{}
 	wg.Add(r.NumCPU)
@@ -94,6 +113,70 @@ func (r *ImageRenderer) RenderBvh(b *bvh.BVH, cam *Camera, buff Buffer) {
 	wg.Wait()
 }
 
+func (r *ImageRenderer) renderPackets(b bvh.PacketTraversable, cam *Camera, buff Buffer) {
+	size := r.PacketSize
+	if size*size > bvh.MAX_PACKET_SIZE {
+		size = int(math.Sqrt(bvh.MAX_PACKET_SIZE))
+	}
+
+	width := buff.Width()
+	height := buff.Height()
+	tilesX := (width + size - 1) / size
+	tilesY := (height + size - 1) / size
+
+	jobs := make(chan int, tilesX*tilesY)
+	wg := sync.WaitGroup{}
+	wg.Add(r.NumCPU)
+
+	for i := 0; i < r.NumCPU; i++ {
+		go func(ctx context) {
+			rays := make([]m.Ray, size*size)
+			hits := make([]scene.Hit, size*size)
+			pixels := make([][2]int, size*size)
+			for tile := range jobs {
+				x0 := (tile % tilesX) * size
+				y0 := (tile / tilesX) * size
+
+				for s := 0; s < r.Spp; s++ {
+					n := 0
+					for y := y0; y < y0+size && y < height; y++ {
+						for x := x0; x < x0+size && x < width; x++ {
+							u, v := r.Sampling(ctx, x, y, width, height)
+							rays[n].Origin = cam.orientation.origin
+							cam.castRayReuse(u, v, &rays[n])
+							pixels[n] = [2]int{x, y}
+							n++
+						}
+					}
+
+					packet := bvh.NewRayPacket(rays[:n])
+					mask := b.ClosestHitPacket(&packet, 0.001, math.Inf(1), hits)
+					for i := 0; i < n; i++ {
+						x, y := pixels[i][0], pixels[i][1]
+						if mask&(1<<i) != 0 {
+							buff.AddSample(x, y, r.ClosestHitShader.Hit(ctx, r, rays[i], &hits[i]))
+						} else {
+							buff.AddSample(x, y, r.MissShader.Miss(ctx, r, rays[i]))
+						}
+					}
+				}
+			}
+			wg.Done()
+		}(context{
+			rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+			bvh:   b,
+			depth: 0,
+		})
+	}
+
+	for tile := 0; tile < tilesX*tilesY; tile++ {
+		jobs <- tile
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
 type Sampling func(ctx context, x, y, w, h int) (u, v float64)
 
 func RandomSampling(ctx context, x, y, w, h int) (u, v float64) {
@@ -33,6 +33,33 @@ func (shader *LitShader) Hit(ctx context, renderer *ImageRenderer, r m.Ray, h *s
 
 }
 
+// Shades hits by the fraction of random directions around the normal that are not occluded within the given distance
+type AmbientOcclusionShader struct {
+	Samples  int
+	Distance float64
+}
+
+func (shader *AmbientOcclusionShader) Hit(ctx context, renderer *ImageRenderer, r m.Ray, h *scene.Hit) scene.Color {
+	normal := h.Normal.Unit()
+	ray := m.Ray{}
+	visible := 0
+	for i := 0; i < shader.Samples; i++ {
+		// Cosine weighted directions, as for diffuse materials
+		direction := normal.Add(m.RandomUnitVector(ctx.rand))
+		if direction.ApproxZero() {
+			direction = normal
+		}
+
+		ray.Reuse(h.Point, direction)
+		if !ctx.bvh.Occluded(ray, 0.0001, shader.Distance/direction.Length()) {
+			visible++
+		}
+	}
+
+	factor := float64(visible) / float64(shader.Samples)
+	return scene.NewColor(factor, factor, factor)
+}
+
 type MissShader interface {
 	Miss(context, *ImageRenderer, m.Ray) scene.Color
 }
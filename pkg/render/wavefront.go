@@ -0,0 +1,221 @@
+package render
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	"github.com/schmizzel/go-graphics/pkg/internal/morton"
+	"github.com/schmizzel/go-graphics/pkg/internal/sort"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+)
+
+const (
+	WAVEFRONT_CHUNK_SIZE = 256 // Number of consecutive rays traced by a worker at once
+
+	wavefrontBucketBits = 12
+	wavefrontMortonBits = 20 // Bits per axis, so that the octant fits into the upper bits of the sort key
+)
+
+// Renders the same image as an ImageRenderer with a LitShader, but instead of tracing every path recursively,
+// the rays of all paths are queued per bounce. The queue is sorted by direction octant and the Morton code of
+// the ray origins, so that rays traced after each other visit similar parts of the BVH.
+type WavefrontRenderer struct {
+	NumCPU     int
+	Spp        int
+	MaxDepth   int
+	MissShader MissShader // Called with the equivalent ImageRenderer, see WavefrontRenderer.ImageRenderer
+	Sampling   Sampling
+}
+
+func NewWavefrontRenderer() *WavefrontRenderer {
+	return &WavefrontRenderer{
+		NumCPU:     runtime.GOMAXPROCS(0),
+		Spp:        300,
+		MaxDepth:   5,
+		MissShader: NewDefaultMissShader(),
+		Sampling:   RandomSampling,
+	}
+}
+
+// Returns the ImageRenderer that renders the same image by tracing every path recursively.
+// It is passed to the MissShader, which may depend on the settings of the renderer
+func (r *WavefrontRenderer) ImageRenderer() *ImageRenderer {
+	return &ImageRenderer{
+		NumCPU:           r.NumCPU,
+		Spp:              r.Spp,
+		ClosestHitShader: &LitShader{MaxDepth: r.MaxDepth},
+		MissShader:       r.MissShader,
+		Sampling:         r.Sampling,
+	}
+}
+
+type wavefrontPath struct {
+	ray        m.Ray
+	hit        scene.Hit
+	throughput scene.Color // Product of the attenuations of all previous bounces
+	radiance   scene.Color // Light gathered so far
+	depth      int
+	active     bool
+	x, y       int
+}
+
+type queuedRay struct {
+	key  uint64
+	path int32
+}
+
+func (r *WavefrontRenderer) RenderBvh(b bvh.Traversable, cam *Camera, buff Buffer) {
+	width := buff.Width()
+	height := buff.Height()
+
+	contexts := make([]context, r.NumCPU)
+	for i := range contexts {
+		contexts[i] = context{
+			rand: rand.New(rand.NewSource(time.Now().UnixNano() + int64(i))),
+			bvh:  b,
+		}
+	}
+
+	image := r.ImageRenderer()
+	paths := make([]wavefrontPath, width*height)
+	queue := make([]queuedRay, 0, len(paths))
+	for s := 0; s < r.Spp; s++ {
+		r.parallel(len(paths), contexts, func(ctx context, start, end int) {
+			for i := start; i < end; i++ {
+				x, y := i%width, i/width
+				u, v := r.Sampling(ctx, x, y, width, height)
+
+				p := &paths[i]
+				*p = wavefrontPath{x: x, y: y, active: true, throughput: scene.NewColor(1, 1, 1)}
+				p.ray.Origin = cam.orientation.origin
+				cam.castRayReuse(u, v, &p.ray)
+			}
+		})
+
+		queue = queue[:0]
+		for i := range paths {
+			queue = append(queue, queuedRay{path: int32(i)})
+		}
+
+		for len(queue) > 0 {
+			sortRays(queue, paths, r.NumCPU)
+			r.parallel(len(queue), contexts, func(ctx context, start, end int) {
+				for _, q := range queue[start:end] {
+					r.trace(ctx, image, &paths[q.path])
+				}
+			})
+
+			// Only keep paths that continue with another bounce
+			n := 0
+			for _, q := range queue {
+				if paths[q.path].active {
+					queue[n] = q
+					n++
+				}
+			}
+			queue = queue[:n]
+		}
+
+		for i := range paths {
+			buff.AddSample(paths[i].x, paths[i].y, paths[i].radiance)
+		}
+	}
+}
+
+// Extends the path by a single bounce, accumulating light in the same way as LitShader
+func (r *WavefrontRenderer) trace(ctx context, image *ImageRenderer, p *wavefrontPath) {
+	tMin := 0.0001
+	if p.depth == 0 {
+		tMin = 0.001
+	}
+
+	if !ctx.bvh.ClosestHit(p.ray, tMin, math.Inf(1), &p.hit) {
+		p.radiance = p.radiance.Add(r.MissShader.Miss(ctx, image, p.ray).Blend(p.throughput))
+		p.active = false
+		return
+	}
+
+	if p.depth > r.MaxDepth {
+		p.active = false
+		return
+	}
+
+	p.depth++
+	p.radiance = p.radiance.Add(p.hit.Material.EmittedLight().Blend(p.throughput))
+	scattered, attenuation := p.hit.Material.Scatter(&p.ray, &p.hit, ctx.rand)
+	if !scattered {
+		p.active = false
+		return
+	}
+	p.throughput = p.throughput.Blend(attenuation)
+}
+
+// Processes [0, n) in chunks of consecutive indices, each worker uses its own context
+func (r *WavefrontRenderer) parallel(n int, contexts []context, process func(ctx context, start, end int)) {
+	jobs := make(chan int, n/WAVEFRONT_CHUNK_SIZE+1)
+	for start := 0; start < n; start += WAVEFRONT_CHUNK_SIZE {
+		jobs <- start
+	}
+	close(jobs)
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(contexts))
+	for _, ctx := range contexts {
+		go func(ctx context) {
+			for start := range jobs {
+				end := start + WAVEFRONT_CHUNK_SIZE
+				if end > n {
+					end = n
+				}
+				process(ctx, start, end)
+			}
+			wg.Done()
+		}(ctx)
+	}
+	wg.Wait()
+}
+
+// Sorts the queued rays by the octant of their direction and then by the Morton code of their origin
+// within the bounds of all queued origins. Ties keep the pixel order, which is coherent for primary rays
+func sortRays(queue []queuedRay, paths []wavefrontPath, threads int) {
+	min := paths[queue[0].path].ray.Origin
+	max := min
+	for _, q := range queue[1:] {
+		min = m.MinVec(min, paths[q.path].ray.Origin)
+		max = m.MaxVec(max, paths[q.path].ray.Origin)
+	}
+	extent := max.Sub(min)
+
+	for i := range queue {
+		ray := &paths[queue[i].path].ray
+		octant := uint64(ray.Sign[0] | ray.Sign[1]<<1 | ray.Sign[2]<<2)
+		code := morton.EncodeCompute(
+			quantize(ray.Origin.X, min.X, extent.X),
+			quantize(ray.Origin.Y, min.Y, extent.Y),
+			quantize(ray.Origin.Z, min.Z, extent.Z),
+		)
+		queue[i].key = octant<<(3*wavefrontMortonBits) | code
+	}
+
+	// The octant occupies the bits directly above the Morton code, buckets are selected by the highest bits
+	shift := 3*wavefrontMortonBits + 3 - wavefrontBucketBits
+	job := sort.SortJob[queuedRay]{
+		BucketIndex:     func(q queuedRay) uint { return uint(q.key >> shift) },
+		Less:            func(a, b queuedRay) bool { return a.key < b.key || a.key == b.key && a.path < b.path },
+		Items:           queue,
+		NumberOfBuckets: 1 << wavefrontBucketBits,
+	}
+	sort.BucketSort(job, threads)
+}
+
+func quantize(v, min, extent float64) uint64 {
+	if extent <= 0 {
+		return 0
+	}
+	return uint64((v - min) / extent * float64(1<<wavefrontMortonBits-1))
+}
@@ -0,0 +1,94 @@
+package render_test
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/schmizzel/go-graphics/pkg/bvh"
+	m "github.com/schmizzel/go-graphics/pkg/math"
+	"github.com/schmizzel/go-graphics/pkg/render"
+	"github.com/schmizzel/go-graphics/pkg/scene"
+	"github.com/stretchr/testify/require"
+)
+
+// Sums the samples of every pixel
+type sumBuffer struct {
+	width, height int
+	sums          []scene.Color
+	samples       []int
+}
+
+func newSumBuffer(width, height int) *sumBuffer {
+	return &sumBuffer{
+		width:   width,
+		height:  height,
+		sums:    make([]scene.Color, width*height),
+		samples: make([]int, width*height),
+	}
+}
+
+func (b *sumBuffer) AddSample(x, y int, c scene.Color) {
+	i := y*b.width + x
+	b.sums[i] = b.sums[i].Add(c)
+	b.samples[i]++
+}
+
+func (b *sumBuffer) Width() int {
+	return b.width
+}
+
+func (b *sumBuffer) Height() int {
+	return b.height
+}
+
+func (b *sumBuffer) mean(i int) scene.Color {
+	return b.sums[i].Div(float64(b.samples[i]))
+}
+
+func TestWavefrontRenderer(t *testing.T) {
+	mesh, err := scene.ParseFromPath("../../assets/suzanne.obj")
+	require.NoError(t, err)
+	model := scene.NewNode().SetMesh(mesh).SetMaterial(scene.Diffuse{Albedo: scene.NewColor(0.8, 0.6, 0.4)})
+	model.FitInside(scene.NewAABB(m.NewVector3(-1, -1, -1), m.NewVector3(1, 1, 1)), m.NewVector3(0.5, 0.5, 0.5))
+	light := scene.NewNode().SetMesh(scene.NewSphere(4)).SetMaterial(scene.Light{Color: scene.NewColor(1, 1, 1), Emitance: 1})
+	light.Translate(0, 0, 8)
+	p, mat := scene.NewNode().AddChild(model).AddChild(light).CollectPrimitives()
+	tree := bvh.DefaultLBVH(p, mat, runtime.NumCPU())
+
+	// The light is behind the camera and missed rays are black, so all light reaches the camera after at least one bounce
+	cam := render.NewCamera(1, 40).SetPosition(0, 0, 3.5).SetUp(0, 1, 0).LookAt(0, 0, 0)
+
+	const size = 24
+	const spp = 128
+	wavefront := render.NewWavefrontRenderer()
+	wavefront.Spp = spp
+	actual := newSumBuffer(size, size)
+	wavefront.RenderBvh(tree, cam, actual)
+
+	// The equivalent renderer traces the same paths recursively and matches the default renderer
+	lit := wavefront.ImageRenderer()
+	require.Equal(t, render.NewDefaultRenderer().ClosestHitShader, lit.ClosestHitShader)
+	require.Equal(t, wavefront.MissShader, lit.MissShader)
+	expected := newSumBuffer(size, size)
+	lit.RenderBvh(tree, cam, expected)
+
+	// Both images converge to the same result, so only the noise of the samples differs
+	meanExpected, meanActual, difference := 0.0, 0.0, 0.0
+	for i := range expected.sums {
+		require.Equal(t, spp, expected.samples[i])
+		require.Equal(t, spp, actual.samples[i])
+		e := expected.mean(i)
+		a := actual.mean(i)
+		meanExpected += (e.X + e.Y + e.Z) / 3
+		meanActual += (a.X + a.Y + a.Z) / 3
+		difference += (math.Abs(e.X-a.X) + math.Abs(e.Y-a.Y) + math.Abs(e.Z-a.Z)) / 3
+	}
+	pixels := float64(size * size)
+	meanExpected /= pixels
+	meanActual /= pixels
+	difference /= pixels
+	require.Greater(t, meanExpected, 0.01)
+	require.InEpsilon(t, meanExpected, meanActual, 0.1)
+	require.Less(t, difference, meanExpected/2)
+}
@@ -20,7 +20,12 @@ func NewAABB(min, max m.Vector3) AABB {
 	return bouding
 }
 
+// Returns an empty box at the origin if there are no primitives
 func EnclosingAABB(primitives []Primitive) AABB {
+	if len(primitives) == 0 {
+		return NewAABB(m.NewVector3(0, 0, 0), m.NewVector3(0, 0, 0))
+	}
+
 	enclosing := primitives[0].Bounding()
 	for i := 1; i < len(primitives); i++ {
 		enclosing = enclosing.Add(primitives[i].Bounding())
@@ -28,6 +33,22 @@ func EnclosingAABB(primitives []Primitive) AABB {
 	return enclosing
 }
 
+// Returns the bounds of the centers of the primitive boxes, or an empty box at the origin if there are no primitives
+func EnclosingCentroids(primitives []Primitive) AABB {
+	if len(primitives) == 0 {
+		return NewAABB(m.NewVector3(0, 0, 0), m.NewVector3(0, 0, 0))
+	}
+
+	min := primitives[0].Bounding().Barycenter
+	max := min
+	for i := 1; i < len(primitives); i++ {
+		center := primitives[i].Bounding().Barycenter
+		min = m.MinVec(min, center)
+		max = m.MaxVec(max, center)
+	}
+	return NewAABB(min, max)
+}
+
 func (a *AABB) Update() {
 	min := a.Bounds[0]
 	max := a.Bounds[1]
@@ -45,15 +66,42 @@ func (a AABB) Add(b AABB) AABB {
 	return NewAABB(m.MinVec(a.Bounds[0], b.Bounds[0]), m.MaxVec(a.Bounds[1], b.Bounds[1]))
 }
 
+// Returns true if both boxes overlap or touch
+func (a AABB) Overlaps(b AABB) bool {
+	return a.Bounds[0].X <= b.Bounds[1].X && a.Bounds[1].X >= b.Bounds[0].X &&
+		a.Bounds[0].Y <= b.Bounds[1].Y && a.Bounds[1].Y >= b.Bounds[0].Y &&
+		a.Bounds[0].Z <= b.Bounds[1].Z && a.Bounds[1].Z >= b.Bounds[0].Z
+}
+
+// Returns the overlapping region of both boxes and false if they do not overlap
+func (a AABB) Intersect(b AABB) (AABB, bool) {
+	min := m.MaxVec(a.Bounds[0], b.Bounds[0])
+	max := m.MinVec(a.Bounds[1], b.Bounds[1])
+	if min.X > max.X || min.Y > max.Y || min.Z > max.Z {
+		return AABB{}, false
+	}
+	return NewAABB(min, max), true
+}
+
+// Returns the point inside the box closest to p, which is p itself if it lies inside the box
+func (a AABB) ClosestPoint(p m.Vector3) m.Vector3 {
+	return m.MinVec(m.MaxVec(p, a.Bounds[0]), a.Bounds[1])
+}
+
 func (a AABB) Size() m.Vector3 {
 	return a.Bounds[1].Sub(a.Bounds[0])
 }
 
 func (AABB AABB) Intersected(ray m.Ray, tMin, tMax float64) bool {
-	tXmin := (AABB.Bounds[ray.Sign[0]].X - ray.Origin.X) * ray.InvDirection.X
-	tXmax := (AABB.Bounds[1-ray.Sign[0]].X - ray.Origin.X) * ray.InvDirection.X
-	tYmin := (AABB.Bounds[ray.Sign[1]].Y - ray.Origin.Y) * ray.InvDirection.Y
-	tYmax := (AABB.Bounds[1-ray.Sign[1]].Y - ray.Origin.Y) * ray.InvDirection.Y
+	return BoundsIntersected(&AABB.Bounds, ray, tMin, tMax)
+}
+
+// Slab test against the given min and max bounds, allows compact node layouts to skip the derived AABB fields
+func BoundsIntersected(bounds *[2]m.Vector3, ray m.Ray, tMin, tMax float64) bool {
+	tXmin := (bounds[ray.Sign[0]].X - ray.Origin.X) * ray.InvDirection.X
+	tXmax := (bounds[1-ray.Sign[0]].X - ray.Origin.X) * ray.InvDirection.X
+	tYmin := (bounds[ray.Sign[1]].Y - ray.Origin.Y) * ray.InvDirection.Y
+	tYmax := (bounds[1-ray.Sign[1]].Y - ray.Origin.Y) * ray.InvDirection.Y
 
 	if tXmin > tYmax || tYmin > tXmax {
 		return false
@@ -65,8 +113,8 @@ func (AABB AABB) Intersected(ray m.Ray, tMin, tMax float64) bool {
 		tXmax = tYmax
 	}
 
-	tZmin := (AABB.Bounds[ray.Sign[2]].Z - ray.Origin.Z) * ray.InvDirection.Z
-	tZmax := (AABB.Bounds[1-ray.Sign[2]].Z - ray.Origin.Z) * ray.InvDirection.Z
+	tZmin := (bounds[ray.Sign[2]].Z - ray.Origin.Z) * ray.InvDirection.Z
+	tZmax := (bounds[1-ray.Sign[2]].Z - ray.Origin.Z) * ray.InvDirection.Z
 
 	if tXmin > tZmax || tZmin > tXmax {
 		return false
@@ -9,6 +9,8 @@ type Hit struct {
 	T         float64   // distance along the intersection ray
 	Primitive Primitive
 	Material  Material
+
+	PrimitiveId int // Index of the hit primitive, only set by queries returning multiple hits and by generic trees
 }
 
 type Intersectable interface {
@@ -85,3 +85,30 @@ func (n *Node) collect(t math.Matrix4) (primitives []Primitive, materials []Mate
 
 	return
 }
+
+// Mesh placed in the scene with the accumulated transformation of its node and all ancestors
+type MeshInstance struct {
+	Mesh      Mesh
+	Transform math.Matrix4
+	Material  Material
+}
+
+// Collects all meshes of the subtree without transforming their primitives,
+// so that meshes referenced by multiple nodes can be shared
+func (n *Node) CollectInstances() []MeshInstance {
+	return n.collectInstances(math.IdentityMatrix(), nil)
+}
+
+func (n *Node) collectInstances(t math.Matrix4, acc []MeshInstance) []MeshInstance {
+	t = t.MultiplyMatrix(n.transformation)
+
+	if n.mesh != nil {
+		acc = append(acc, MeshInstance{Mesh: n.mesh, Transform: t, Material: n.material})
+	}
+
+	for _, child := range n.children {
+		acc = child.collectInstances(t, acc)
+	}
+
+	return acc
+}
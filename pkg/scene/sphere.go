@@ -78,6 +78,15 @@ func (s *Sphere) Intersected(ray m.Ray, tMin, tMax float64, hitOut *Hit) bool {
 	return true
 }
 
+// Returns the point on the surface of the sphere closest to p
+func (s *Sphere) ClosestPoint(p m.Vector3) m.Vector3 {
+	direction := p.Sub(s.center)
+	if direction.ApproxZero() {
+		return s.center.Add(m.NewVector3(s.radius, 0, 0))
+	}
+	return s.center.Add(direction.Unit().Mul(s.radius))
+}
+
 func newSphereAt(x, y, z, radius float64) *Sphere {
 	s := &Sphere{
 		center: m.NewVector3(x, y, z),
@@ -76,41 +76,182 @@ func (t *Triangle) Primitives() []Primitive {
 }
 
 func (tri *Triangle) Intersected(ray m.Ray, tMin, tMax float64, hitOut *Hit) bool {
+	t, u, v, det, ok := tri.intersect(ray, tMin, tMax)
+	if !ok {
+		return false
+	}
+
+	hitOut.Point = ray.At(t)
+	hitOut.FrontFace = det > 0
+	hitOut.Normal = tri.normal(u, v)
+	if !hitOut.FrontFace {
+		hitOut.Normal = hitOut.Normal.Mul(-1)
+	}
+	hitOut.T = t
+	return true
+}
+
+// Only determines whether the triangle is hit, without computing the hit point and normal
+func (tri *Triangle) Occluded(ray m.Ray, tMin, tMax float64) bool {
+	_, _, _, _, ok := tri.intersect(ray, tMin, tMax)
+	return ok
+}
+
+func (tri *Triangle) intersect(ray m.Ray, tMin, tMax float64) (t, u, v, det float64, ok bool) {
 	// Implementation of the Möller-Trumbore algorithm
 	pvec := ray.Direction.Cross(tri.v0v2)
-	det := tri.v0v1.Dot(pvec)
+	det = tri.v0v1.Dot(pvec)
 
 	// If det is close to 0, Triangle and ray are parallel => no intersection
 	if m.ApproxZero(det) {
-		return false
+		return
 	}
 
 	invDet := 1 / det
 	tvec := ray.Origin.Sub(tri.vertecies[0].Position)
-	u := tvec.Dot(pvec) * invDet
+	u = tvec.Dot(pvec) * invDet
 	if u < 0 || u > 1 {
-		return false
+		return
 	}
 
 	qvec := tvec.Cross(tri.v0v1)
-	v := ray.Direction.Dot(qvec) * invDet
+	v = ray.Direction.Dot(qvec) * invDet
 	if v < 0 || u+v > 1 {
-		return false
+		return
 	}
 
-	t := tri.v0v2.Dot(qvec) * invDet
-	if t < tMin || t > tMax {
-		return false
+	t = tri.v0v2.Dot(qvec) * invDet
+	return t, u, v, det, t >= tMin && t <= tMax
+}
+
+// Returns the point on the triangle closest to p (Ericson 2004, Real-Time Collision Detection 5.1.5)
+func (tri *Triangle) ClosestPoint(p m.Vector3) m.Vector3 {
+	a := tri.vertecies[0].Position
+	b := tri.vertecies[1].Position
+	c := tri.vertecies[2].Position
+	ab := tri.v0v1
+	ac := tri.v0v2
+
+	// Vertex region of a
+	ap := p.Sub(a)
+	d1 := ab.Dot(ap)
+	d2 := ac.Dot(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a
 	}
 
-	hitOut.Point = ray.At(t)
-	hitOut.FrontFace = det > 0
-	hitOut.Normal = tri.normal(u, v)
-	if !hitOut.FrontFace {
-		hitOut.Normal = hitOut.Normal.Mul(-1)
+	// Vertex region of b
+	bp := p.Sub(b)
+	d3 := ab.Dot(bp)
+	d4 := ac.Dot(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b
 	}
-	hitOut.T = t
-	return true
+
+	// Edge region of ab
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return a.Add(ab.Mul(d1 / (d1 - d3)))
+	}
+
+	// Vertex region of c
+	cp := p.Sub(c)
+	d5 := ab.Dot(cp)
+	d6 := ac.Dot(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c
+	}
+
+	// Edge region of ac
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return a.Add(ac.Mul(d2 / (d2 - d6)))
+	}
+
+	// Edge region of bc
+	va := d3*d6 - d5*d4
+	if va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		return b.Add(c.Sub(b).Mul((d4 - d3) / ((d4 - d3) + (d5 - d6))))
+	}
+
+	// Inside the face
+	denom := 1 / (va + vb + vc)
+	return a.Add(ab.Mul(vb * denom)).Add(ac.Mul(vc * denom))
+}
+
+// Clips the triangle against the given box and returns the bounding box of the remaining polygon.
+// Returns false if no part of the triangle lies inside the box
+func (tri *Triangle) ClippedBounding(box AABB) (AABB, bool) {
+	polygon := tri.clip(box)
+	if len(polygon) == 0 {
+		return AABB{}, false
+	}
+
+	min := polygon[0]
+	max := polygon[0]
+	for _, p := range polygon[1:] {
+		min = m.MinVec(min, p)
+		max = m.MaxVec(max, p)
+	}
+
+	// Guard against points slightly outside the box due to floating point errors
+	return NewAABB(min, max).Intersect(box)
+}
+
+// Returns the area of the part of the triangle that lies inside the box
+func (tri *Triangle) ClippedArea(box AABB) float64 {
+	polygon := tri.clip(box)
+	if len(polygon) < 3 {
+		return 0
+	}
+
+	// The clipped polygon is convex, so it can be split into a fan of triangles
+	sum := m.NewVector3(0, 0, 0)
+	for i := 1; i < len(polygon)-1; i++ {
+		sum = sum.Add(polygon[i].Sub(polygon[0]).Cross(polygon[i+1].Sub(polygon[0])))
+	}
+	return sum.Length() / 2
+}
+
+// Sutherland-Hodgman clipping against all six planes of the box.
+// Returns the vertices of the remaining polygon, which is empty if the triangle lies outside the box
+func (tri *Triangle) clip(box AABB) []m.Vector3 {
+	polygon := make([]m.Vector3, 0, 9)
+	clipped := make([]m.Vector3, 0, 9)
+	for _, v := range tri.vertecies {
+		polygon = append(polygon, v.Position)
+	}
+
+	for axis := 0; axis < 3; axis++ {
+		for side := 0; side < 2; side++ {
+			plane := box.Bounds[side].Component(axis)
+			inside := func(p m.Vector3) bool {
+				if side == 0 {
+					return p.Component(axis) >= plane
+				}
+				return p.Component(axis) <= plane
+			}
+
+			clipped = clipped[:0]
+			for i, current := range polygon {
+				previous := polygon[(i+len(polygon)-1)%len(polygon)]
+				if inside(current) != inside(previous) {
+					t := (plane - previous.Component(axis)) / (current.Component(axis) - previous.Component(axis))
+					clipped = append(clipped, previous.Add(current.Sub(previous).Mul(t)))
+				}
+				if inside(current) {
+					clipped = append(clipped, current)
+				}
+			}
+
+			polygon, clipped = clipped, polygon
+			if len(polygon) == 0 {
+				return nil
+			}
+		}
+	}
+
+	return polygon
 }
 
 // Takes u and v barycentric coordinates and returns the normal at point p